@@ -1,114 +1,218 @@
 package commatrix
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/liornoy/node-comm-lib/pkg/client"
-	"github.com/liornoy/node-comm-lib/pkg/endpointslices"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
 	"github.com/liornoy/node-comm-lib/pkg/types"
 )
 
-type Env int
-
-const (
-	Baremetal Env = iota
-	AWS
-)
+// Options configures the sources of the ComMatrix created by NewWithOptions.
+type Options struct {
+	// ClientSet is used to access the cluster. When nil, a client is created
+	// from KubeconfigPath.
+	ClientSet *client.ClientSet
+	// KubeconfigPath is the kubeconfig used to access the cluster when ClientSet is nil.
+	KubeconfigPath string
+	// Env selects the static entries of the cluster environment, Auto detects it
+	// from the cluster. The zero value is Baremetal.
+	Env Env
+	// StaticEntriesFS overrides the embedded static entries, and must have the
+	// same <major.minor>/<platform>.yaml layout.
+	StaticEntriesFS fs.FS
+	// CustomEntriesPaths are JSON, YAML or CSV files of custom entries added to the matrix.
+	CustomEntriesPaths []string
+	// CustomEntriesConfigMaps are ConfigMaps holding custom entries, read
+	// through the cluster client.
+	CustomEntriesConfigMaps []ConfigMapRef
+	// CustomEntries are added to the matrix as is.
+	CustomEntries []types.ComDetails
+	// DisableEndpointSlices skips the entries discovered from the EndpointSlices.
+	DisableEndpointSlices bool
+	// DisableStaticEntries skips the static entries.
+	DisableStaticEntries bool
+	// Sources are additional sources, run after the built-in ones.
+	Sources []Source
+	// PerNode sets the node name of the entries discovered from the
+	// EndpointSlices, creating an entry per node rather than per node role.
+	PerNode bool
+	// Roles selects the node roles the entries discovered from the
+	// EndpointSlices and the static entries are created for. The zero value
+	// selects the master role of control plane nodes and the worker role of
+	// the other nodes. When Roles.Pools is set, the entries are created per
+	// MachineConfigPool instead.
+	Roles nodes.RoleSelector
+	// SourceNames, when set, restricts the sources which run to the ones with
+	// these names, e.g. only EndpointSlicesSourceName.
+	SourceNames []string
+}
 
 // New initializes a ComMatrix using Kubernetes cluster data.
+// ctx bounds the cluster requests, cancelling it aborts the generation.
 // It takes kubeconfigPath for cluster access to  fetch EndpointSlice objects,
 // detailing open ports for ingress traffic.
 // customEntriesPath allows adding custom entries from a JSON file to the matrix.
+// e selects the static entries of the cluster environment, Auto detects it from the cluster.
+// The static entries are selected by the cluster version and environment.
+// The node roles of the entries are adjusted to the detected cluster topology.
 // Returns a pointer to ComMatrix and error. Entries include traffic direction, protocol,
 // port number, namespace, service name, pod, container, node role, and flow optionality for OpenShift.
-func New(kubeconfigPath string, customEntriesPath string, e Env) (*types.ComMatrix, error) {
-	res := make([]types.ComDetails, 0)
+func New(ctx context.Context, kubeconfigPath string, customEntriesPath string, e Env) (*types.ComMatrix, error) {
+	opts := Options{
+		KubeconfigPath: kubeconfigPath,
+		Env:            e,
+	}
+	if customEntriesPath != "" {
+		opts.CustomEntriesPaths = []string{customEntriesPath}
+	}
 
-	cs, err := client.New(kubeconfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed creating the k8s client: %w", err)
+	return NewWithOptions(ctx, opts)
+}
+
+// NewWithOptions initializes a ComMatrix as New does, from the sources configured by opts.
+func NewWithOptions(ctx context.Context, opts Options) (*types.ComMatrix, error) {
+	var err error
+
+	cs := opts.ClientSet
+	if cs == nil {
+		cs, err = client.New(opts.KubeconfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed creating the k8s client: %w", err)
+		}
 	}
 
-	epSlicesInfo, err := endpointslices.GetIngressEndpointSlicesInfo(cs)
+	sources, err := opts.sources(cs)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting endpointslices: %w", err)
+		return nil, err
 	}
 
-	epSliceComDetails, err := endpointslices.ToComDetails(cs, epSlicesInfo)
+	res, report, err := collect(ctx, sources)
 	if err != nil {
 		return nil, err
 	}
-	res = append(res, epSliceComDetails...)
 
-	staticEntries, err := getStaticEntries(e)
+	topology, err := DetectTopology(ctx, cs)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed detecting the cluster topology: %w", err)
 	}
+	log.Debugf("detected cluster topology: %s", topology)
 
-	res = append(res, staticEntries...)
+	res = ApplyTopology(res, topology)
 
-	if customEntriesPath != "" {
-		customComDetails, err := addFromFile(customEntriesPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed fetching custom entries from file %s err: %w", customEntriesPath, err)
+	// The networks are only needed by the source restricted exports, so
+	// clusters missing them, e.g. without an install-config, are supported.
+	networks, err := DetectNetworks(ctx, cs)
+	if err != nil {
+		log.Warnf("failed detecting the cluster networks, source restricted exports are unavailable: %v", err)
+	}
+
+	return &types.ComMatrix{Matrix: res, CustomEntriesReport: &report, Networks: networks}, nil
+}
+
+// sources returns the built-in sources enabled by opts followed by opts.Sources,
+// restricted to opts.SourceNames when set.
+func (opts Options) sources(cs *client.ClientSet) ([]Source, error) {
+	all := []Source{}
+	if !opts.DisableEndpointSlices {
+		all = append(all, &EndpointSlicesSource{ClientSet: cs, PerNode: opts.PerNode, Roles: opts.Roles})
+	}
+	if !opts.DisableStaticEntries {
+		all = append(all, &StaticEntriesSource{ClientSet: cs, Env: opts.Env, FS: opts.StaticEntriesFS, Roles: opts.Roles})
+	}
+	if len(opts.CustomEntriesPaths) > 0 || len(opts.CustomEntriesConfigMaps) > 0 || len(opts.CustomEntries) > 0 {
+		all = append(all, &CustomEntriesSource{
+			Paths:      opts.CustomEntriesPaths,
+			ConfigMaps: opts.CustomEntriesConfigMaps,
+			ClientSet:  cs,
+			Entries:    opts.CustomEntries,
+		})
+	}
+	all = append(all, opts.Sources...)
+
+	if len(opts.SourceNames) == 0 {
+		return all, nil
+	}
+
+	selected := sets.New[string](opts.SourceNames...)
+	res := []Source{}
+	for _, s := range all {
+		if selected.Has(s.Name()) {
+			res = append(res, s)
+			selected.Delete(s.Name())
 		}
+	}
 
-		res = append(res, customComDetails...)
+	if selected.Len() > 0 {
+		return nil, fmt.Errorf("unknown or disabled sources: %s", strings.Join(sets.List(selected), ", "))
 	}
 
-	return &types.ComMatrix{Matrix: res}, nil
+	return res, nil
 }
 
-func addFromFile(fp string) ([]types.ComDetails, error) {
-	var res []types.ComDetails
-	f, err := os.Open(filepath.Clean(fp))
+// NewFromFile initializes a ComMatrix from a JSON, YAML or CSV file, such as
+// the custom entries file or the output of the ComMatrix exporters.
+func NewFromFile(fp string) (*types.ComMatrix, error) {
+	res, err := addFromFile(fp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %v", fp, err)
+		return nil, err
 	}
-	defer f.Close()
-	raw, err := io.ReadAll(f)
+
+	return &types.ComMatrix{Matrix: res}, nil
+}
+
+// ReadCustomEntriesFile reads the custom entries of a JSON, YAML or CSV file,
+// detecting the format by the file extension or content, and validates them.
+// Matrix files are valid custom entries files, adding all their entries.
+func ReadCustomEntriesFile(fp string) ([]types.CustomEntry, error) {
+	raw, err := readFile(fp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file %s: %v", fp, err)
+		return nil, err
 	}
 
-	err = json.Unmarshal(raw, &res)
+	res, err := types.ParseCustomEntries(raw, types.DetectFormat(fp, raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal custom entries file: %v", err)
+		return nil, fmt.Errorf("invalid custom entries file %s:\n%w", fp, err)
 	}
 
 	return res, nil
 }
 
-func getStaticEntries(e Env) ([]types.ComDetails, error) {
-	var (
-		envComDetails     []types.ComDetails
-		genericComDetails []types.ComDetails
-	)
-	switch e {
-	case Baremetal:
-		err := json.Unmarshal([]byte(baremetalStaticEntries), &envComDetails)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal static entries: %v", err)
-		}
-	case AWS:
-		err := json.Unmarshal([]byte(awsCloudStaticEntries), &envComDetails)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal static entries: %v", err)
-		}
-	default:
-		return nil, fmt.Errorf("invalid value for cluster environment")
+// addFromFile reads the entries of a JSON, YAML or CSV file, detecting the
+// format by the file extension or content, and validates them.
+func addFromFile(fp string) ([]types.ComDetails, error) {
+	raw, err := readFile(fp)
+	if err != nil {
+		return nil, err
 	}
 
-	err := json.Unmarshal([]byte(generalStaticEntries), &genericComDetails)
+	res, err := types.ParseComDetails(raw, types.DetectFormat(fp, raw))
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal static entries: %v", err)
+		return nil, fmt.Errorf("invalid entries file %s:\n%w", fp, err)
 	}
 
-	res := append(envComDetails, genericComDetails...)
-
 	return res, nil
 }
+
+func readFile(fp string) ([]byte, error) {
+	f, err := os.Open(filepath.Clean(fp))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %v", fp, err)
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", fp, err)
+	}
+
+	return raw, nil
+}
@@ -0,0 +1,441 @@
+package commatrix
+
+import (
+	"context"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+func TestStaticEntries(t *testing.T) {
+	fsys, err := fs.Sub(staticEntriesFS, "static-entries")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := staticEntriesVersions(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range versions {
+		for e := range envNames {
+			if e == Auto {
+				continue
+			}
+
+			res, err := readStaticEntries(fsys, v.String(), e)
+			if err != nil {
+				t.Fatalf("failed reading static entries of %s %s: %v", v, e, err)
+			}
+
+			for i, cd := range res {
+				if err := cd.Validate(); err != nil {
+					t.Fatalf("invalid static entry %d of %s %s: %v", i, v, e, err)
+				}
+			}
+		}
+
+		files, err := fs.ReadDir(fsys, v.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			name := strings.TrimSuffix(f.Name(), ".yaml")
+			if _, err := ParseEnv(name); f.Name() != generalStaticEntriesFile && (err != nil || name == "auto") {
+				t.Fatalf("unexpected static entries file %s/%s", v, f.Name())
+			}
+		}
+	}
+}
+
+func TestSelectStaticEntriesVersion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"4.14/general.yaml": &fstest.MapFile{},
+		"4.16/general.yaml": &fstest.MapFile{},
+	}
+	tests := []struct {
+		clusterVersion string
+		expected       string
+	}{
+		{clusterVersion: "4.13.2", expected: "4.14"},
+		{clusterVersion: "4.14.0", expected: "4.14"},
+		{clusterVersion: "4.15.9", expected: "4.14"},
+		{clusterVersion: "4.16.1", expected: "4.16"},
+		{clusterVersion: "4.17.0-rc.1", expected: "4.16"},
+	}
+	for _, test := range tests {
+		res, err := selectStaticEntriesVersion(fsys, test.clusterVersion)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.clusterVersion, err)
+		}
+		if res.String() != test.expected {
+			t.Fatalf("test %s failed. expected %s got %s", test.clusterVersion, test.expected, res)
+		}
+	}
+}
+
+func TestParseEnv(t *testing.T) {
+	for e, name := range envNames {
+		res, err := ParseEnv(name)
+		if err != nil {
+			t.Fatalf("failed parsing %s: %v", name, err)
+		}
+		if res != e {
+			t.Fatalf("parsing %s: expected %v got %v", name, e, res)
+		}
+	}
+
+	if _, err := ParseEnv("invalid"); err == nil {
+		t.Fatalf("expected an error parsing an invalid environment")
+	}
+}
+
+func TestApplyTopology(t *testing.T) {
+	comDetails := []types.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "worker", Service: "sshd"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(443), NodeRole: "worker", Service: "router"},
+	}
+	tests := []struct {
+		desc     string
+		topology Topology
+		expected []types.ComDetails
+	}{
+		{
+			desc:     "highly-available",
+			topology: HighlyAvailable,
+			expected: comDetails,
+		},
+		{
+			desc:     "single-node",
+			topology: SingleNode,
+			expected: []types.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(443), NodeRole: "master", Service: "router"},
+			},
+		},
+	}
+	for _, test := range tests {
+		res := ApplyTopology(comDetails, test.topology)
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+	}
+}
+
+func TestApplyPools(t *testing.T) {
+	comDetails := []types.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(443), NodeRole: "worker", Service: "router"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(80), NodeRole: "edge", Service: "edge"},
+	}
+	pools := map[string][]string{"master": {"master"}, "worker": {"infra", "worker"}}
+	expected := []types.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(443), NodeRole: "infra", Service: "router"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(443), NodeRole: "worker", Service: "router"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(80), NodeRole: "edge", Service: "edge"},
+	}
+
+	res := ApplyPools(comDetails, pools)
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("test apply-pools failed. expected %v got %v", expected, res)
+	}
+}
+
+func TestApplyPoolsRoles(t *testing.T) {
+	nodeList := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "master-0", Labels: map[string]string{"node-role.kubernetes.io/master": ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-0", Labels: map[string]string{"node-role.kubernetes.io/worker": ""}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "infra-0", Labels: map[string]string{"node-role.kubernetes.io/worker": "", "node-role.kubernetes.io/infra": ""}}},
+	}
+	static := []types.ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+		{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(10250), NodeRole: "worker", Service: "kubelet"},
+	}
+
+	tests := []struct {
+		desc     string
+		selector nodes.RoleSelector
+		expected []types.ComDetails
+	}{
+		{
+			desc:     "default",
+			selector: nodes.RoleSelector{},
+			expected: static,
+		},
+		{
+			desc:     "custom-roles",
+			selector: nodes.RoleSelector{Roles: []string{"infra", "master", "worker"}},
+			expected: []types.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "master", Service: "sshd"},
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(10250), NodeRole: "infra", Service: "kubelet"},
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(10250), NodeRole: "worker", Service: "kubelet"},
+			},
+		},
+		{
+			desc:     "unselected-role",
+			selector: nodes.RoleSelector{Roles: []string{"infra", "worker"}},
+			expected: []types.ComDetails{
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(10250), NodeRole: "infra", Service: "kubelet"},
+				{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(10250), NodeRole: "worker", Service: "kubelet"},
+			},
+		},
+	}
+	for _, test := range tests {
+		res := ApplyPools(static, poolsByRole(nodeList, test.selector))
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+	}
+}
+
+type fakeSource struct {
+	name    string
+	entries []types.ComDetails
+}
+
+func (s *fakeSource) Name() string {
+	return s.name
+}
+
+func (s *fakeSource) ComDetails(_ context.Context) ([]types.ComDetails, error) {
+	return s.entries, nil
+}
+
+func TestSources(t *testing.T) {
+	cmdb := &fakeSource{name: "cmdb", entries: []types.ComDetails{{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(8443), NodeRole: "worker"}}}
+	custom := types.ComDetails{Direction: "ingress", Protocol: "UDP", Port: types.SinglePort(4789), NodeRole: "master"}
+	opts := Options{
+		DisableEndpointSlices: true,
+		DisableStaticEntries:  true,
+		CustomEntries:         []types.ComDetails{custom},
+		Sources:               []Source{cmdb},
+	}
+	tests := []struct {
+		desc        string
+		sourceNames []string
+		expected    []types.ComDetails
+		expectErr   bool
+	}{
+		{
+			desc:     "all-sources",
+			expected: []types.ComDetails{cmdb.entries[0], custom},
+		},
+		{
+			desc:        "selected-source",
+			sourceNames: []string{"cmdb"},
+			expected:    cmdb.entries,
+		},
+		{
+			desc:        "disabled-source",
+			sourceNames: []string{EndpointSlicesSourceName},
+			expectErr:   true,
+		},
+	}
+	for _, test := range tests {
+		opts.SourceNames = test.sourceNames
+		sources, err := opts.sources(nil)
+		if test.expectErr {
+			if err == nil {
+				t.Fatalf("test %s failed. expected an error", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.desc, err)
+		}
+
+		res, _, err := collect(context.Background(), sources)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.desc, err)
+		}
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+	}
+}
+
+func TestReadCustomEntriesConfigMap(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: "commatrix"},
+		Data: map[string]string{
+			"b.csv": "action,protocol,port\nremove,TCP,111\n",
+			"a.yaml": `- direction: ingress
+  protocol: UDP
+  port: "4789"
+  nodeRole: worker
+`,
+		},
+	}
+	cs := &client.ClientSet{CoreV1Interface: fake.NewSimpleClientset(cm).CoreV1()}
+
+	tests := []struct {
+		ref      string
+		expected []types.CustomEntry
+	}{
+		{
+			ref: "openshift-config/commatrix:b.csv",
+			expected: []types.CustomEntry{
+				{Action: types.ActionRemove, ComDetails: types.ComDetails{Protocol: "TCP", Port: types.SinglePort(111)}},
+			},
+		},
+		{
+			ref: "openshift-config/commatrix",
+			expected: []types.CustomEntry{
+				{ComDetails: types.ComDetails{Direction: "ingress", Protocol: "UDP", Port: types.SinglePort(4789), NodeRole: "worker"}},
+				{Action: types.ActionRemove, ComDetails: types.ComDetails{Protocol: "TCP", Port: types.SinglePort(111)}},
+			},
+		},
+	}
+	for _, test := range tests {
+		ref, err := ParseConfigMapRef(test.ref)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.ref, err)
+		}
+
+		res, err := readCustomEntriesConfigMap(context.Background(), cs, ref)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.ref, err)
+		}
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.ref, test.expected, res)
+		}
+	}
+
+	if _, err := ParseConfigMapRef("commatrix:a.yaml"); err == nil {
+		t.Fatalf("expected an error parsing a reference without namespace")
+	}
+}
+
+func TestCustomEntriesSourceReadsOnce(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "openshift-config", Name: "commatrix"},
+		Data:       map[string]string{"entries.csv": "action,direction,protocol,port,nodeRole\n,ingress,UDP,4789,worker\nremove,,TCP,111,\n"},
+	}
+	fakeClient := fake.NewSimpleClientset(cm)
+	gets := 0
+	fakeClient.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+
+	s := &CustomEntriesSource{
+		ConfigMaps: []ConfigMapRef{{Namespace: "openshift-config", Name: "commatrix"}},
+		ClientSet:  &client.ClientSet{CoreV1Interface: fakeClient.CoreV1()},
+	}
+	added, err := s.ComDetails(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	modifications, err := s.Modifications(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	if len(added) != 1 || len(modifications) != 1 || gets != 1 {
+		t.Fatalf("test failed. expected 1 entry, 1 modification and 1 read got %d, %d and %d", len(added), len(modifications), gets)
+	}
+}
+
+func TestCompareListeningPerNode(t *testing.T) {
+	opts := Options{PerNode: true}
+	if s := NewSSSource(opts); !s.PerNode {
+		t.Fatalf("test ss-source failed. expected a per node source got %+v", s)
+	}
+
+	sshd := types.ComDetails{Direction: "ingress", Protocol: "TCP", Port: types.SinglePort(22), NodeRole: "worker", SourceNetwork: types.NetworkMachine}
+	worker1, worker2 := sshd, sshd
+	worker1.NodeName, worker2.NodeName = "worker-1", "worker-2"
+	listening1, listening2 := worker1, worker2
+	listening1.SourceNetwork, listening2.SourceNetwork = "", ""
+	m := &types.ComMatrix{Matrix: []types.ComDetails{worker1, worker2}}
+
+	undocumented, notListening := CompareListening(m, []types.ComDetails{listening1, listening2}, types.DefaultKey)
+	if len(undocumented.Matrix) != 0 || len(notListening.Matrix) != 0 {
+		t.Fatalf("test per-node failed. expected no differences got %v and %v", undocumented.Matrix, notListening.Matrix)
+	}
+
+	// The ports listened on by the other node are not listened on by worker-2.
+	_, notListening = CompareListening(m, []types.ComDetails{listening1}, types.DefaultKey)
+	expected := worker2
+	expected.SourceNetwork = ""
+	if !reflect.DeepEqual(notListening.Matrix, []types.ComDetails{expected}) {
+		t.Fatalf("test per-node-missing failed. expected %v got %v", []types.ComDetails{expected}, notListening.Matrix)
+	}
+}
+
+func TestSSSourceRoles(t *testing.T) {
+	worker := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Labels: map[string]string{"node-role.kubernetes.io/worker": ""}}}
+	fakeClient := fake.NewSimpleClientset(worker)
+	pods := 0
+	fakeClient.PrependReactor("create", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		pods++
+		return false, nil, nil
+	})
+
+	opts := Options{
+		ClientSet: &client.ClientSet{CoreV1Interface: fakeClient.CoreV1()},
+		Roles:     nodes.RoleSelector{Roles: []string{"infra"}},
+	}
+	s := NewSSSource(opts)
+	if !reflect.DeepEqual(s.Roles, opts.Roles) {
+		t.Fatalf("test ss-source failed. expected roles %+v got %+v", opts.Roles, s.Roles)
+	}
+
+	// None of the roles of worker-1 is selected, so ss doesn't run on it.
+	res, err := s.ComDetails(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if len(res) != 0 || pods != 0 {
+		t.Fatalf("test unselected-node failed. expected no entries and debug pods got %v and %d", res, pods)
+	}
+}
+
+func TestSSSourcePools(t *testing.T) {
+	edge := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "edge-1", Labels: map[string]string{"node-role.kubernetes.io/edge": ""}}}
+	fakeClient := fake.NewSimpleClientset(edge)
+	pods := 0
+	fakeClient.PrependReactor("create", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		pods++
+		return false, nil, nil
+	})
+
+	pools := []nodes.Pool{
+		{Name: "master", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/master": ""})},
+		{Name: "worker", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/worker": ""})},
+	}
+	opts := Options{
+		ClientSet: &client.ClientSet{CoreV1Interface: fakeClient.CoreV1()},
+		Roles:     nodes.RoleSelector{Roles: []string{"edge"}, Pools: pools},
+	}
+	s := NewSSSource(opts)
+	if !reflect.DeepEqual(s.Roles.Pools, pools) {
+		t.Fatalf("test ss-source failed. expected pools %+v got %+v", pools, s.Roles.Pools)
+	}
+
+	// No pool selects edge-1, so ss doesn't run on it, although its role is
+	// listed, as the roles are ignored when grouping by pool.
+	res, err := s.ComDetails(context.Background())
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+	if len(res) != 0 || pods != 0 {
+		t.Fatalf("test unselected-node failed. expected no entries and debug pods got %v and %d", res, pods)
+	}
+}
@@ -0,0 +1,85 @@
+package commatrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/clusterconfig"
+)
+
+type Env int
+
+const (
+	Baremetal Env = iota
+	AWS
+	VSphere
+	Azure
+	GCP
+	OpenStack
+	Nutanix
+	None
+)
+
+// Auto makes New detect the environment from the platform type of the cluster.
+const Auto Env = -1
+
+var envNames = map[Env]string{
+	Auto:      "auto",
+	Baremetal: "baremetal",
+	AWS:       "aws",
+	VSphere:   "vsphere",
+	Azure:     "azure",
+	GCP:       "gcp",
+	OpenStack: "openstack",
+	Nutanix:   "nutanix",
+	None:      "none",
+}
+
+// platformTypes maps the platform types of the Infrastructure resource
+// to the environment with the matching static entries.
+var platformTypes = map[string]Env{
+	"BareMetal": Baremetal,
+	"AWS":       AWS,
+	"VSphere":   VSphere,
+	"Azure":     Azure,
+	"GCP":       GCP,
+	"OpenStack": OpenStack,
+	"Nutanix":   Nutanix,
+	"None":      None,
+}
+
+func (e Env) String() string {
+	if name, ok := envNames[e]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Env(%d)", int(e))
+}
+
+// ParseEnv returns the Env matching the given name, case insensitive.
+func ParseEnv(name string) (Env, error) {
+	for e, n := range envNames {
+		if strings.EqualFold(n, name) {
+			return e, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid cluster environment %q", name)
+}
+
+// DetectEnv returns the Env matching the platform type of the cluster.
+func DetectEnv(ctx context.Context, cs *client.ClientSet) (Env, error) {
+	platformType, err := clusterconfig.GetPlatformType(ctx, cs)
+	if err != nil {
+		return 0, err
+	}
+
+	e, ok := platformTypes[platformType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported platform type %q", platformType)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,24 @@
+package commatrix
+
+import (
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+// CompareListening compares the ingress entries of the matrix with the ports
+// the nodes listen on, as collected by the SSSource of the same options, and
+// returns the listened on ports missing from the matrix and the matrix
+// entries no node listens on. The entries are compared by key, without their
+// sources, as ss doesn't report who connects to the ports.
+func CompareListening(m *types.ComMatrix, listening []types.ComDetails, key types.Key) (undocumented types.ComMatrix, notListening types.ComMatrix) {
+	ingress := types.ComMatrix{}
+	for _, cd := range m.Matrix {
+		if cd.Direction == consts.IngressLabel {
+			cd.SourceRole, cd.SourceNetwork, cd.SourceCIDR = "", "", ""
+			ingress.Matrix = append(ingress.Matrix, cd)
+		}
+	}
+	listened := types.ComMatrix{Matrix: listening}
+
+	return listened.DiffByKey(ingress, key), ingress.DiffByKey(listened, key)
+}
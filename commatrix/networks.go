@@ -0,0 +1,30 @@
+package commatrix
+
+import (
+	"context"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/clusterconfig"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+// DetectNetworks returns the networks of the cluster: the pod and service
+// networks of the Network/cluster resource, and the machine networks of the
+// install-config.
+func DetectNetworks(ctx context.Context, cs *client.ClientSet) (*types.ClusterNetworks, error) {
+	podNetworks, serviceNetworks, err := clusterconfig.GetNetworks(ctx, cs)
+	if err != nil {
+		return nil, err
+	}
+
+	machineNetworks, err := clusterconfig.GetMachineNetworks(ctx, cs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ClusterNetworks{
+		MachineNetworks: machineNetworks,
+		PodNetworks:     podNetworks,
+		ServiceNetworks: serviceNetworks,
+	}, nil
+}
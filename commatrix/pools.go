@@ -0,0 +1,65 @@
+package commatrix
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+// DetectPoolsByRole returns the roles, or MachineConfigPools, selected by the
+// selector for the nodes of each default node role, master or worker.
+func DetectPoolsByRole(ctx context.Context, cs *client.ClientSet, selector nodes.RoleSelector) (map[string][]string, error) {
+	nodeList, err := cs.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing nodes: %w", err)
+	}
+
+	return poolsByRole(nodeList.Items, selector), nil
+}
+
+func poolsByRole(nodeList []corev1.Node, selector nodes.RoleSelector) map[string][]string {
+	pools := map[string]sets.Set[string]{}
+	for i := range nodeList {
+		node := &nodeList[i]
+		for _, role := range (nodes.RoleSelector{}).Select(node) {
+			if pools[role] == nil {
+				pools[role] = sets.New[string]()
+			}
+			pools[role].Insert(selector.Select(node)...)
+		}
+	}
+
+	res := map[string][]string{}
+	for role, names := range pools {
+		res[role] = sets.List(names)
+	}
+
+	return res
+}
+
+// ApplyPools moves the entries of each node role to the roles, or pools,
+// selected for the nodes of that role, creating an entry per selected one.
+// Entries of roles without nodes are kept as is.
+func ApplyPools(comDetails []types.ComDetails, poolsByRole map[string][]string) []types.ComDetails {
+	res := make([]types.ComDetails, 0, len(comDetails))
+	for _, cd := range comDetails {
+		pools, ok := poolsByRole[cd.NodeRole]
+		if !ok {
+			res = append(res, cd)
+			continue
+		}
+		for _, pool := range pools {
+			cd.NodeRole = pool
+			res = append(res, cd)
+		}
+	}
+
+	return types.RemoveDups(res)
+}
@@ -0,0 +1,385 @@
+package commatrix
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/clusterconfig"
+	"github.com/liornoy/node-comm-lib/pkg/endpointslices"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/ss"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+// Names of the built-in sources.
+const (
+	EndpointSlicesSourceName = "endpointslices"
+	StaticEntriesSourceName  = "static-entries"
+	CustomEntriesSourceName  = "custom-entries"
+	SSSourceName             = "ss"
+)
+
+// Source contributes entries to the communication matrix.
+type Source interface {
+	// Name identifies the source, e.g. in logs and when selecting which sources run.
+	Name() string
+	// ComDetails returns the entries of the source.
+	ComDetails(ctx context.Context) ([]types.ComDetails, error)
+}
+
+// Modifier is implemented by sources which also remove or override the entries
+// of the other sources. The modifications are applied once all the sources ran.
+type Modifier interface {
+	Modifications(ctx context.Context) ([]types.CustomEntry, error)
+}
+
+// EndpointSlicesSource discovers the ingress ports of the cluster from its EndpointSlices.
+type EndpointSlicesSource struct {
+	ClientSet *client.ClientSet
+	// PerNode sets the node name of the entries, creating an entry per node
+	// the endpoints are on rather than per node role.
+	PerNode bool
+	// Roles selects the node roles entries are created for.
+	Roles nodes.RoleSelector
+}
+
+func (s *EndpointSlicesSource) Name() string {
+	return EndpointSlicesSourceName
+}
+
+func (s *EndpointSlicesSource) ComDetails(ctx context.Context) ([]types.ComDetails, error) {
+	epSlicesInfo, err := endpointslices.GetIngressEndpointSlicesInfo(ctx, s.ClientSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting endpointslices: %w", err)
+	}
+
+	return endpointslices.ToComDetailsWithOptions(ctx, s.ClientSet, epSlicesInfo, endpointslices.Options{PerNode: s.PerNode, Roles: s.Roles})
+}
+
+// StaticEntriesSource returns the static entries matching the version and
+// environment of the cluster.
+type StaticEntriesSource struct {
+	ClientSet *client.ClientSet
+	// Env selects the static entries of the cluster environment, Auto detects it
+	// from the cluster.
+	Env Env
+	// FS overrides the embedded static entries when set.
+	FS fs.FS
+	// Roles, when set, moves the entries of each node role to the roles, or
+	// pools, selected for the nodes of that role.
+	Roles nodes.RoleSelector
+}
+
+func (s *StaticEntriesSource) Name() string {
+	return StaticEntriesSourceName
+}
+
+func (s *StaticEntriesSource) ComDetails(ctx context.Context) ([]types.ComDetails, error) {
+	e := s.Env
+	if e == Auto {
+		detected, err := DetectEnv(ctx, s.ClientSet)
+		if err != nil {
+			return nil, fmt.Errorf("failed detecting the cluster environment: %w", err)
+		}
+		log.Infof("detected cluster environment: %s", detected)
+		e = detected
+	}
+
+	version, err := clusterconfig.GetVersion(ctx, s.ClientSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the cluster version: %w", err)
+	}
+
+	fsys := s.FS
+	if fsys == nil {
+		fsys, err = fs.Sub(staticEntriesFS, "static-entries")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := getStaticEntries(fsys, version, e)
+	if err != nil || (len(s.Roles.Roles) == 0 && !s.Roles.All && len(s.Roles.Pools) == 0) {
+		return res, err
+	}
+
+	pools, err := DetectPoolsByRole(ctx, s.ClientSet, s.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	return ApplyPools(res, pools), nil
+}
+
+// CustomEntriesSource returns user-defined entries, read from JSON, YAML or
+// CSV files and ConfigMaps followed by the in-memory ones. The file and
+// ConfigMap entries with the remove or override action modify the entries
+// of the other sources. The files and ConfigMaps are read once, by the first
+// call of ComDetails or Modifications, so both use the same entries.
+type CustomEntriesSource struct {
+	Paths []string
+	// ConfigMaps are read through ClientSet.
+	ConfigMaps []ConfigMapRef
+	ClientSet  *client.ClientSet
+	Entries    []types.ComDetails
+
+	readOnce      sync.Once
+	customEntries []types.CustomEntry
+	readErr       error
+}
+
+// ConfigMapRef references custom entries stored in a ConfigMap.
+type ConfigMapRef struct {
+	Namespace string
+	Name      string
+	// Key of the custom entries in the ConfigMap data. When empty, the
+	// entries of all the keys are read, sorted by key.
+	Key string
+}
+
+func (r ConfigMapRef) String() string {
+	if r.Key == "" {
+		return fmt.Sprintf("%s/%s", r.Namespace, r.Name)
+	}
+
+	return fmt.Sprintf("%s/%s:%s", r.Namespace, r.Name, r.Key)
+}
+
+// ParseConfigMapRef parses a ConfigMap reference of the form namespace/name[:key].
+func ParseConfigMapRef(s string) (ConfigMapRef, error) {
+	ref, key, _ := strings.Cut(s, ":")
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found || namespace == "" || name == "" {
+		return ConfigMapRef{}, fmt.Errorf("invalid ConfigMap reference %q, expected namespace/name[:key]", s)
+	}
+
+	return ConfigMapRef{Namespace: namespace, Name: name, Key: key}, nil
+}
+
+func (s *CustomEntriesSource) Name() string {
+	return CustomEntriesSourceName
+}
+
+func (s *CustomEntriesSource) ComDetails(ctx context.Context) ([]types.ComDetails, error) {
+	customEntries, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]types.ComDetails, 0)
+	for _, ce := range customEntries {
+		if ce.Action == "" || ce.Action == types.ActionAdd {
+			res = append(res, ce.ComDetails)
+		}
+	}
+
+	return append(res, s.Entries...), nil
+}
+
+func (s *CustomEntriesSource) Modifications(ctx context.Context) ([]types.CustomEntry, error) {
+	customEntries, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]types.CustomEntry, 0)
+	for _, ce := range customEntries {
+		if ce.Action == types.ActionRemove || ce.Action == types.ActionOverride {
+			res = append(res, ce)
+		}
+	}
+
+	return res, nil
+}
+
+// read returns the custom entries of the files followed by the ones of the
+// ConfigMaps, reading them on the first call.
+func (s *CustomEntriesSource) read(ctx context.Context) ([]types.CustomEntry, error) {
+	s.readOnce.Do(func() {
+		s.customEntries, s.readErr = s.readAll(ctx)
+	})
+
+	return s.customEntries, s.readErr
+}
+
+func (s *CustomEntriesSource) readAll(ctx context.Context) ([]types.CustomEntry, error) {
+	res := make([]types.CustomEntry, 0)
+	for _, fp := range s.Paths {
+		customEntries, err := ReadCustomEntriesFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("failed fetching custom entries from file %s err: %w", fp, err)
+		}
+
+		res = append(res, customEntries...)
+	}
+
+	for _, ref := range s.ConfigMaps {
+		customEntries, err := readCustomEntriesConfigMap(ctx, s.ClientSet, ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed fetching custom entries from ConfigMap %s err: %w", ref, err)
+		}
+
+		res = append(res, customEntries...)
+	}
+
+	return res, nil
+}
+
+// readCustomEntriesConfigMap reads the custom entries of a ConfigMap key, or of
+// all its keys if the reference has none, detecting their format by the key
+// extension or content.
+func readCustomEntriesConfigMap(ctx context.Context, cs *client.ClientSet, ref ConfigMapRef) ([]types.CustomEntry, error) {
+	if cs == nil {
+		return nil, fmt.Errorf("no client to read the ConfigMap with")
+	}
+
+	cm, err := cs.ConfigMaps(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	for k, v := range cm.Data {
+		data[k] = []byte(v)
+	}
+	for k, v := range cm.BinaryData {
+		data[k] = v
+	}
+
+	keys := []string{ref.Key}
+	if ref.Key == "" {
+		keys = sets.List(sets.KeySet(data))
+	}
+
+	res := make([]types.CustomEntry, 0)
+	for _, key := range keys {
+		raw, ok := data[key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found", key)
+		}
+
+		customEntries, err := types.ParseCustomEntries(raw, types.DetectFormat(key, raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom entries in key %s:\n%w", key, err)
+		}
+
+		res = append(res, customEntries...)
+	}
+
+	return res, nil
+}
+
+// SSSource returns the ports the cluster nodes listen on, collected by running
+// ss on each node through a debug pod.
+type SSSource struct {
+	ClientSet *client.ClientSet
+	// PerNode keeps the node name of the entries, rather than merging the
+	// entries of the nodes of the same role.
+	PerNode bool
+	// Roles selects the node roles entries are created for.
+	Roles nodes.RoleSelector
+}
+
+// NewSSSource returns the ss source of the cluster of opts, creating its
+// entries per node and for the node roles, or pools, as opts configures the
+// other sources, so its entries can be compared with theirs.
+func NewSSSource(opts Options) *SSSource {
+	return &SSSource{ClientSet: opts.ClientSet, PerNode: opts.PerNode, Roles: opts.Roles}
+}
+
+func (s *SSSource) Name() string {
+	return SSSourceName
+}
+
+func (s *SSSource) ComDetails(ctx context.Context) ([]types.ComDetails, error) {
+	nodesList, err := s.ClientSet.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed listing nodes: %w", err)
+	}
+
+	res := make([]types.ComDetails, 0)
+	for i := range nodesList.Items {
+		// The entries of the nodes none of whose roles is selected, or which
+		// no pool selects, would be dropped, so ss doesn't run on them.
+		if len(s.Roles.Select(&nodesList.Items[i])) == 0 {
+			if len(s.Roles.Pools) > 0 {
+				log.Warnf("skipping node %s, no MachineConfigPool selects it", nodesList.Items[i].Name)
+			} else {
+				log.Debugf("skipping node %s, none of its roles is selected", nodesList.Items[i].Name)
+			}
+			continue
+		}
+
+		cds, err := ss.CreateComDetailsFromNode(ctx, s.ClientSet, &nodesList.Items[i], s.Roles)
+		if err != nil {
+			return nil, fmt.Errorf("failed collecting listening ports from node %s: %w", nodesList.Items[i].Name, err)
+		}
+		res = append(res, cds...)
+	}
+
+	if !s.PerNode {
+		for i := range res {
+			res[i].NodeName = ""
+		}
+	}
+
+	return types.RemoveDups(res), nil
+}
+
+// collect returns the entries of all the sources, after applying the
+// modifications of the Modifier sources to the entries of the other sources.
+// The entries of the Modifier sources are not modified and come last.
+func collect(ctx context.Context, sources []Source) ([]types.ComDetails, types.CustomEntriesReport, error) {
+	base := make([]types.ComDetails, 0)
+	modifiersEntries := make([]types.ComDetails, 0)
+	modifications := make([]types.CustomEntry, 0)
+	for _, s := range sources {
+		if err := ctx.Err(); err != nil {
+			return nil, types.CustomEntriesReport{}, err
+		}
+
+		cds, err := s.ComDetails(ctx)
+		if err != nil {
+			return nil, types.CustomEntriesReport{}, fmt.Errorf("source %s: %w", s.Name(), err)
+		}
+		log.Debugf("source %s returned %d entries", s.Name(), len(cds))
+
+		m, ok := s.(Modifier)
+		if !ok {
+			base = append(base, cds...)
+			continue
+		}
+
+		mods, err := m.Modifications(ctx)
+		if err != nil {
+			return nil, types.CustomEntriesReport{}, fmt.Errorf("source %s: %w", s.Name(), err)
+		}
+		modifiersEntries = append(modifiersEntries, cds...)
+		modifications = append(modifications, mods...)
+	}
+
+	res, report := types.ApplyCustomEntries(base, modifications)
+	logCustomEntriesReport(report)
+
+	return append(res, modifiersEntries...), report, nil
+}
+
+func logCustomEntriesReport(report types.CustomEntriesReport) {
+	for _, cd := range report.Removed {
+		log.Infof("custom entries removed: %s", cd)
+	}
+	for _, o := range report.Overridden {
+		log.Infof("custom entries overrode: %s with: %s", o.Old, o.New)
+	}
+	for _, ce := range report.Unmatched {
+		log.Warnf("custom entry matched no entry: %s", ce)
+	}
+}
@@ -0,0 +1,169 @@
+package commatrix
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+const generalStaticEntriesFile = "general.yaml"
+
+// staticEntriesFS holds the static entries of each OpenShift minor version,
+// organized as static-entries/<major.minor>/<platform>.yaml, with the entries
+// common to all platforms in general.yaml.
+//
+//go:embed static-entries
+var staticEntriesFS embed.FS
+
+type minorVersion struct {
+	major int
+	minor int
+}
+
+func (v minorVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+func (v minorVersion) less(other minorVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+
+	return v.minor < other.minor
+}
+
+// parseMinorVersion returns the major and minor parts of a version such as "4.15" or "4.15.3".
+func parseMinorVersion(version string) (minorVersion, error) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return minorVersion{}, fmt.Errorf("invalid version %q", version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return minorVersion{}, fmt.Errorf("invalid version %q: %w", version, err)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return minorVersion{}, fmt.Errorf("invalid version %q: %w", version, err)
+	}
+
+	return minorVersion{major: major, minor: minor}, nil
+}
+
+// staticEntriesVersions returns the versions the static entries are available for, sorted.
+func staticEntriesVersions(fsys fs.FS) ([]minorVersion, error) {
+	dirs, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed listing static entries versions: %w", err)
+	}
+
+	res := make([]minorVersion, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		v, err := parseMinorVersion(dir.Name())
+		if err != nil {
+			return nil, fmt.Errorf("invalid static entries directory %s: %w", dir.Name(), err)
+		}
+		res = append(res, v)
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no static entries versions found")
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].less(res[j]) })
+
+	return res, nil
+}
+
+// selectStaticEntriesVersion returns the newest static entries version which is not newer
+// than the cluster version, so clusters of versions the tool does not know yet
+// use the entries of the latest known version. Clusters older than every known
+// version use the oldest one.
+func selectStaticEntriesVersion(fsys fs.FS, clusterVersion string) (minorVersion, error) {
+	cv, err := parseMinorVersion(clusterVersion)
+	if err != nil {
+		return minorVersion{}, err
+	}
+
+	versions, err := staticEntriesVersions(fsys)
+	if err != nil {
+		return minorVersion{}, err
+	}
+
+	res := versions[0]
+	for _, v := range versions {
+		if cv.less(v) {
+			break
+		}
+		res = v
+	}
+
+	if res != cv {
+		log.Warnf("no static entries for version %s, using the static entries of version %s", cv, res)
+	}
+
+	return res, nil
+}
+
+func getStaticEntries(fsys fs.FS, clusterVersion string, e Env) ([]types.ComDetails, error) {
+	version, err := selectStaticEntriesVersion(fsys, clusterVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return readStaticEntries(fsys, version.String(), e)
+}
+
+// readStaticEntries returns the general static entries and the ones of the environment
+// for the given version directory.
+func readStaticEntries(fsys fs.FS, version string, e Env) ([]types.ComDetails, error) {
+	name, ok := envNames[e]
+	if !ok || e == Auto {
+		return nil, fmt.Errorf("invalid value for cluster environment: %s", e)
+	}
+
+	envComDetails, err := readStaticEntriesFile(fsys, path.Join(version, name+".yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	genericComDetails, err := readStaticEntriesFile(fsys, path.Join(version, generalStaticEntriesFile))
+	if err != nil {
+		return nil, err
+	}
+
+	res := append(envComDetails, genericComDetails...)
+
+	return res, nil
+}
+
+func readStaticEntriesFile(fsys fs.FS, fp string) ([]types.ComDetails, error) {
+	var res []types.ComDetails
+
+	raw, err := fs.ReadFile(fsys, fp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read static entries file %s: %w", fp, err)
+	}
+
+	err = yaml.UnmarshalStrict(raw, &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal static entries file %s: %v", fp, err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,93 @@
+package commatrix
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/clusterconfig"
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+type Topology int
+
+const (
+	// HighlyAvailable clusters have dedicated control plane and worker nodes.
+	HighlyAvailable Topology = iota
+	// Compact clusters have three control plane nodes that also carry the worker role.
+	Compact
+	// SingleNode clusters have a single node carrying both roles.
+	SingleNode
+)
+
+const singleReplicaTopology = "SingleReplica"
+
+func (t Topology) String() string {
+	switch t {
+	case HighlyAvailable:
+		return "highly-available"
+	case Compact:
+		return "compact"
+	case SingleNode:
+		return "single-node"
+	default:
+		return fmt.Sprintf("Topology(%d)", int(t))
+	}
+}
+
+// DetectTopology returns the topology of the cluster. Single node clusters are
+// detected by the controlPlaneTopology of the Infrastructure resource, and compact
+// clusters by having no worker nodes which are not control plane nodes as well.
+func DetectTopology(ctx context.Context, cs *client.ClientSet) (Topology, error) {
+	controlPlane, infrastructure, err := clusterconfig.GetTopology(ctx, cs)
+	if err != nil {
+		return 0, err
+	}
+
+	if controlPlane == singleReplicaTopology && infrastructure == singleReplicaTopology {
+		return SingleNode, nil
+	}
+
+	nodeList, err := cs.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed listing nodes: %w", err)
+	}
+
+	for i := range nodeList.Items {
+		if !nodes.HasRole(&nodeList.Items[i], consts.MasterRole) {
+			return HighlyAvailable, nil
+		}
+	}
+
+	return Compact, nil
+}
+
+// ApplyTopology adjusts the node roles of the entries to the given topology.
+// On single node and compact clusters every node carries both the master and
+// the worker roles, so worker entries, and entries from or to workers, are moved
+// to the master role.
+func ApplyTopology(comDetails []types.ComDetails, t Topology) []types.ComDetails {
+	if t == HighlyAvailable {
+		return comDetails
+	}
+
+	res := make([]types.ComDetails, 0, len(comDetails))
+	for _, cd := range comDetails {
+		if cd.NodeRole == consts.WorkerRole {
+			cd.NodeRole = consts.MasterRole
+		}
+		if cd.DestinationRole == consts.WorkerRole {
+			cd.DestinationRole = consts.MasterRole
+		}
+		if cd.SourceRole == consts.WorkerRole {
+			cd.SourceRole = consts.MasterRole
+		}
+		res = append(res, cd)
+	}
+
+	return types.RemoveDups(res)
+}
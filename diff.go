@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+func runDiff(_ context.Context, args []string) int {
+	fs := newFlagSet("diff", "<a> <b>", "Print the entries found only in <a> (prefixed with '-'), only in <b> (prefixed with '+') "+
+		"and the entries of both whose fields not in --key changed (prefixed with '~')")
+	format := fs.String("format", "text", "output format, one of text, csv, json or md")
+	key := addKeyFlag(fs)
+
+	if code, ok := parseFlags(fs, args, 2); !ok {
+		return code
+	}
+	if !diffFormats[*format] {
+		fmt.Fprintf(os.Stderr, "error: unsupported format %q, supported formats are text, csv, json and md\n", *format)
+		return exitUsage
+	}
+
+	a, err := commatrix.NewFromFile(fs.Arg(0))
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	b, err := commatrix.NewFromFile(fs.Arg(1))
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	comparison := a.CompareByKey(*b, *key)
+	out, err := marshalComparison(comparison, *format)
+	if err != nil {
+		return errorf("%v", err)
+	}
+	fmt.Print(string(out))
+
+	if !comparison.IsEmpty() {
+		return exitDiff
+	}
+
+	return exitOK
+}
+
+// diffFormats are the supported output formats of diff.
+var diffFormats = map[string]bool{"text": true, "csv": true, "json": true, "md": true}
+
+func marshalComparison(c types.Comparison, format string) ([]byte, error) {
+	switch format {
+	case "text":
+		return []byte(c.String()), nil
+	case "csv":
+		return c.ToCSV()
+	case "json":
+		out, err := c.ToJSON()
+		return append(out, '\n'), err
+	case "md":
+		return c.ToMarkdown(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/liornoy/node-comm-lib/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+const matrixFileName = "communication-matrix"
+
+// formats maps the supported output formats to the file extension
+// of their artifact.
+var formats = map[string]string{
+	"csv":  "csv",
+	"json": "json",
+	"yaml": "yaml",
+	"nft":  "nft",
+}
+
+// formatsFlag is a repeatable flag collecting output formats,
+// also accepting comma separated values.
+type formatsFlag []string
+
+func (f *formatsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *formatsFlag) Set(value string) error {
+	for _, format := range strings.Split(value, ",") {
+		if _, ok := formats[format]; !ok {
+			return fmt.Errorf("unsupported format %q, supported formats are csv, json, yaml and nft", format)
+		}
+		*f = append(*f, format)
+	}
+
+	return nil
+}
+
+func runGenerate(ctx context.Context, args []string) int {
+	var outFormats formatsFlag
+
+	fs := newFlagSet("generate", "", "Generate the communication matrix of the cluster")
+	mf := addMatrixFlags(fs)
+	fs.Var(&outFormats, "format", "output format, one of csv, json, yaml or nft. can be repeated or comma separated (default csv)")
+	destination := fs.String("destination", "", "directory to write the "+matrixFileName+".<format> files to, the output is printed to stdout if empty. "+
+		"with --per-node, the entries open on each node are written to "+matrixFileName+"-<node>.<format> files as well")
+	restrictSources := fs.Bool("restrict-sources", false, "accept the cluster internal ports of the nft format only from the machine, pod and service networks of the cluster")
+	dropEgress := fs.Bool("drop-egress", false, "drop the egress traffic of the nft format not accepted by the egress entries. "+
+		"the egress entries don't cover all the traffic of the nodes, e.g. to the overlay network, webhooks, cloud APIs, mirror registries and proxies, so by default it is accepted")
+
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+	if *mf.perNode && *destination == "" {
+		fmt.Fprintf(os.Stderr, "error: --per-node requires --destination, the directory the per node files are written to\n")
+		return exitUsage
+	}
+
+	opts, err := mf.options(ctx)
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	if len(outFormats) == 0 {
+		outFormats = formatsFlag{"csv"}
+	}
+
+	res, err := commatrix.NewWithOptions(ctx, opts)
+	if err != nil {
+		return errorf("failed generating the communication matrix: %v", err)
+	}
+
+	nftOpts := types.NftablesOptions{RestrictSources: *restrictSources, DropEgress: *dropEgress}
+
+	if err := writeMatrix(res, outFormats, *destination, matrixFileName, nftOpts); err != nil {
+		return errorf("%v", err)
+	}
+
+	if *mf.perNode {
+		if err := writeNodeMatrices(ctx, opts.ClientSet, opts.Roles, res, outFormats, *destination, nftOpts); err != nil {
+			return errorf("%v", err)
+		}
+	}
+
+	return exitOK
+}
+
+// writeNodeMatrices writes the entries open on each node of the cluster, in
+// each of the given formats, to <fileName>-<node>.<format> files of the
+// destination directory. When grouping the nodes by pool, the entries of the
+// pool of each node are written.
+func writeNodeMatrices(ctx context.Context, cs *client.ClientSet, selector nodes.RoleSelector, m *types.ComMatrix, outFormats []string, destination string, nftOpts types.NftablesOptions) error {
+	nodeList, err := cs.Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed listing nodes: %w", err)
+	}
+
+	for i := range nodeList.Items {
+		node := &nodeList.Items[i]
+		roles := nodes.GetRoles(node)
+		if len(selector.Pools) > 0 {
+			roles = selector.Select(node)
+		}
+		nodeMatrix := m.ForNode(node.Name, roles)
+		if err := writeMatrix(nodeMatrix, outFormats, destination, matrixFileName+"-"+node.Name, nftOpts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMatrix writes the matrix in each of the given formats to <fileName>.<format>
+// files of the destination directory, or to stdout if destination is empty.
+// nftOpts configures the nftables rules.
+func writeMatrix(m *types.ComMatrix, outFormats []string, destination, fileName string, nftOpts types.NftablesOptions) error {
+	if destination != "" {
+		if err := os.MkdirAll(destination, 0o755); err != nil {
+			return fmt.Errorf("failed creating destination directory %s: %w", destination, err)
+		}
+	}
+
+	for _, format := range outFormats {
+		out, err := marshalMatrix(m, format, nftOpts)
+		if err != nil {
+			return fmt.Errorf("failed converting the matrix to %s: %w", format, err)
+		}
+
+		if destination == "" {
+			fmt.Print(string(out))
+			continue
+		}
+
+		fp := filepath.Join(destination, fmt.Sprintf("%s.%s", fileName, formats[format]))
+		if err := os.WriteFile(fp, out, 0o644); err != nil {
+			return fmt.Errorf("failed writing %s: %w", fp, err)
+		}
+	}
+
+	return nil
+}
+
+func marshalMatrix(m *types.ComMatrix, format string, nftOpts types.NftablesOptions) ([]byte, error) {
+	switch format {
+	case "csv":
+		return m.ToCSV()
+	case "json":
+		return m.ToJSON()
+	case "yaml":
+		return m.ToYAML()
+	case "nft":
+		return m.ToNftablesWithOptions(nftOpts)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
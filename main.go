@@ -1,39 +1,327 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/liornoy/node-comm-lib/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/clusterconfig"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
 )
 
+// Exit codes returned by the commatrix CLI.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+	// exitDiff is returned when the command ran successfully but found
+	// differences or invalid entries.
+	exitDiff = 3
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
+
+var commands = []command{
+	{name: "generate", summary: "generate the communication matrix of a cluster", run: runGenerate},
+	{name: "diff", summary: "print the differences between two communication matrix files", run: runDiff},
+	{name: "union", summary: "print the union of two communication matrix files", run: runUnion},
+	{name: "intersect", summary: "print the entries of a communication matrix file found in another", run: runIntersect},
+	{name: "subtract", summary: "print the entries of a communication matrix file not found in another", run: runSubtract},
+	{name: "merge", summary: "merge two communication matrix files, resolving conflicting entries", run: runMerge},
+	{name: "validate", summary: "validate a communication matrix or custom entries file", run: runValidate},
+	{name: "verify", summary: "compare the generated matrix against the ports the nodes listen on", run: runVerify},
+}
+
 var (
-	customEntriesPath = flag.String("custom-entries-path", "", "specifies the path to user-defined custom entries to be added to the communication matrix, formatted as per module specifications.")
-	logLevel          = flag.String("loglevel", "info", "set the log level (debug, info, warn, error, fatal, panic)")
+	logLevel = flag.String("loglevel", "info", "set the log level (debug, info, warn, error, fatal, panic)")
+	timeout  = flag.Duration("timeout", 0, "abort the command after the given duration, e.g. 10m. debug pods created on the nodes are deleted on abort. no timeout if 0")
 )
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	flag.Usage = usage
 	flag.Parse()
 
 	level, err := log.ParseLevel(*logLevel)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: invalid log level '%s'\n", *logLevel)
-		os.Exit(1)
+		return exitUsage
 	}
 	log.SetLevel(level)
 
-	kubeconfig, ok := os.LookupEnv("KUBECONFIG")
-	if !ok {
-		panic("must set the KUBECONFIG environment variable")
+	if flag.NArg() == 0 {
+		usage()
+		return exitUsage
+	}
+
+	// Cancel the context on interrupt or termination, so the resources created
+	// on the cluster are cleaned before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	name := flag.Arg(0)
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(ctx, flag.Args()[1:])
+		}
+	}
+
+	if name == "help" {
+		usage()
+		return exitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "error: unknown command '%s'\n\n", name)
+	usage()
+
+	return exitUsage
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [global flags] <command> [flags] [args]\n\nCommands:\n", progName())
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun '%s <command> -h' for the flags of a command.\n\nGlobal flags:\n", progName())
+	flag.PrintDefaults()
+	fmt.Fprintf(out, "\nExit codes:\n  %d  success\n  %d  error\n  %d  invalid usage\n  %d  differences or invalid entries found\n",
+		exitOK, exitError, exitUsage, exitDiff)
+}
+
+// newFlagSet returns a flag set for the given command, printing the
+// command usage line and its flags on -h.
+func newFlagSet(name, args, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s\n\n%s.\n\nFlags:\n", strings.TrimSpace(fmt.Sprintf("%s %s [flags] %s", progName(), name, args)), summary)
+		fs.PrintDefaults()
 	}
 
-	res, err := commatrix.New(kubeconfig, *customEntriesPath, commatrix.Baremetal)
+	return fs
+}
+
+// parseFlags parses the command args, and returns the exit code to use
+// and false if the command should not proceed.
+func parseFlags(fs *flag.FlagSet, args []string, nArgs int) (int, bool) {
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
+		return exitOK, false
+	}
+	if err != nil {
+		return exitUsage, false
+	}
+
+	if fs.NArg() != nArgs {
+		fmt.Fprintf(os.Stderr, "error: %s expects %d arguments, got %d\n\n", fs.Name(), nArgs, fs.NArg())
+		fs.Usage()
+		return exitUsage, false
+	}
+
+	return exitOK, true
+}
+
+func kubeconfigFlag(fs *flag.FlagSet) *string {
+	return fs.String("kubeconfig", os.Getenv("KUBECONFIG"), "path to the kubeconfig file of the cluster, defaults to the KUBECONFIG environment variable")
+}
+
+// matrixFlags holds the flags configuring the sources of a generated matrix.
+type matrixFlags struct {
+	kubeconfig         *string
+	platform           *commatrix.Env
+	customEntriesPaths stringsFlag
+	customEntriesCMs   stringsFlag
+	staticEntriesDir   *string
+	noEndpointSlices   *bool
+	noStaticEntries    *bool
+	perNode            *bool
+	roles              *string
+	allRoles           *bool
+	groupByPool        *bool
+	sources            stringsFlag
+}
+
+func addMatrixFlags(fs *flag.FlagSet) *matrixFlags {
+	f := &matrixFlags{}
+	f.kubeconfig = kubeconfigFlag(fs)
+	f.platform = platformFlag(fs)
+	fs.Var(&f.customEntriesPaths, "custom-entries-path", "specifies the path to user-defined custom entries to be added to the communication matrix, formatted as per module specifications. can be repeated")
+	fs.Var(&f.customEntriesCMs, "custom-entries-configmap", "ConfigMap holding custom entries to be added to the communication matrix, as namespace/name[:key]. "+
+		"all the keys are read when no key is given. can be repeated")
+	f.staticEntriesDir = fs.String("static-entries-dir", "", "directory of static entries overriding the embedded ones, organized as <major.minor>/<platform>.yaml")
+	f.noEndpointSlices = fs.Bool("no-endpointslices", false, "skip the entries discovered from the EndpointSlices")
+	f.noStaticEntries = fs.Bool("no-static-entries", false, "skip the static entries")
+	f.perNode = fs.Bool("per-node", false, "create the discovered entries per node they are open on, rather than per node role")
+	f.roles = fs.String("roles", "", "comma separated node roles the discovered entries are created for, in priority order. * stands for the roles not listed. "+
+		"defaults to master,worker")
+	f.allRoles = fs.Bool("all-roles", false, "create the discovered entries for every role of a node selected by --roles, rather than only for its highest priority one")
+	f.groupByPool = fs.Bool("group-by-pool", false, "create the entries per MachineConfigPool of the nodes, rather than per node role. --roles and --all-roles are ignored")
+	fs.Var(&f.sources, "source", "run only the given source, one of endpointslices, static-entries, custom-entries or ss. can be repeated. "+
+		"the ss source, collecting the listening ports of the nodes, runs only when selected")
+
+	return f
+}
+
+// options returns the matrix options set by the flags.
+func (f *matrixFlags) options(ctx context.Context) (commatrix.Options, error) {
+	if *f.kubeconfig == "" {
+		return commatrix.Options{}, fmt.Errorf("must set the --kubeconfig flag or the KUBECONFIG environment variable")
+	}
+
+	cs, err := client.New(*f.kubeconfig)
 	if err != nil {
-		panic(err)
+		return commatrix.Options{}, fmt.Errorf("failed creating the k8s client: %w", err)
+	}
+
+	opts := commatrix.Options{
+		ClientSet:             cs,
+		SourceNames:           f.sources,
+		Env:                   *f.platform,
+		CustomEntriesPaths:    f.customEntriesPaths,
+		DisableEndpointSlices: *f.noEndpointSlices,
+		DisableStaticEntries:  *f.noStaticEntries,
+		PerNode:               *f.perNode,
+		Roles:                 f.roleSelector(),
+	}
+	if *f.groupByPool {
+		opts.Roles.Pools, err = clusterconfig.GetMachineConfigPools(ctx, cs)
+		if err != nil {
+			return commatrix.Options{}, err
+		}
 	}
+	for _, s := range f.customEntriesCMs {
+		ref, err := commatrix.ParseConfigMapRef(s)
+		if err != nil {
+			return commatrix.Options{}, err
+		}
+		opts.CustomEntriesConfigMaps = append(opts.CustomEntriesConfigMaps, ref)
+	}
+	for _, name := range f.sources {
+		if name == commatrix.SSSourceName {
+			opts.Sources = append(opts.Sources, commatrix.NewSSSource(opts))
+		}
+	}
+	if *f.staticEntriesDir != "" {
+		opts.StaticEntriesFS = os.DirFS(*f.staticEntriesDir)
+	}
+
+	return opts, nil
+}
+
+// roleSelector returns the node roles selected by the flags.
+func (f *matrixFlags) roleSelector() nodes.RoleSelector {
+	selector := nodes.RoleSelector{All: *f.allRoles}
+	for _, role := range strings.Split(*f.roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			selector.Roles = append(selector.Roles, role)
+		}
+	}
+
+	return selector
+}
+
+func errorf(format string, a ...any) int {
+	fmt.Fprintf(os.Stderr, "error: "+format+"\n", a...)
+	return exitError
+}
+
+func progName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// stringsFlag is a repeatable string flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// envFlag is a flag selecting the cluster environment of the static entries.
+type envFlag struct {
+	env *commatrix.Env
+}
+
+func (f envFlag) String() string {
+	if f.env == nil {
+		return ""
+	}
+
+	return f.env.String()
+}
+
+func (f envFlag) Set(value string) error {
+	e, err := commatrix.ParseEnv(value)
+	if err != nil {
+		return err
+	}
+	*f.env = e
+
+	return nil
+}
+
+func platformFlag(fs *flag.FlagSet) *commatrix.Env {
+	e := commatrix.Auto
+	fs.Var(envFlag{env: &e}, "platform", "cluster platform of the static entries, one of auto, baremetal, aws, vsphere, azure, gcp, openstack, nutanix or none. auto detects it from the Infrastructure resource")
+
+	return &e
+}
+
+// keyFlag is a flag selecting the fields identifying an entry.
+type keyFlag struct {
+	key *types.Key
+}
+
+func (f keyFlag) String() string {
+	if f.key == nil {
+		return ""
+	}
+
+	return f.key.String()
+}
+
+func (f keyFlag) Set(value string) error {
+	key, err := types.ParseKey(value)
+	if err != nil {
+		return err
+	}
+	*f.key = key
+
+	return nil
+}
+
+func addKeyFlag(fs *flag.FlagSet) *types.Key {
+	key := types.DefaultKey
+	fs.Var(keyFlag{key: &key}, "key", "comma separated fields identifying an entry, which must include port. "+
+		"e.g. direction,protocol,port reports whether a port is covered at all, and adding namespace,service whether the exact service is documented")
 
-	fmt.Print(res)
+	return &key
 }
@@ -4,6 +4,7 @@ import (
 	appsv1client "k8s.io/client-go/kubernetes/typed/apps/v1"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	discoveryv1client "k8s.io/client-go/kubernetes/typed/discovery/v1"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -21,6 +22,13 @@ func New(kubeconfigPath string) (*ClientSet, error) {
 		return nil, err
 	}
 
+	return NewFromConfig(config)
+}
+
+// NewFromConfig creates a ClientSet from an existing rest config.
+func NewFromConfig(config *rest.Config) (*ClientSet, error) {
+	var err error
+
 	clientSet := &ClientSet{}
 	clientSet.CoreV1Interface = corev1client.NewForConfigOrDie(config)
 	clientSet.AppsV1Interface = appsv1client.NewForConfigOrDie(config)
@@ -0,0 +1,266 @@
+package clusterconfig
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	rtclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+)
+
+const (
+	clusterResourceName        = "cluster"
+	clusterVersionResourceName = "version"
+	clusterConfigNamespace     = "kube-system"
+	clusterConfigName          = "cluster-config-v1"
+	installConfigKey           = "install-config"
+	// completedState is the state of the updates of the ClusterVersion history
+	// which were fully applied.
+	completedState = "Completed"
+)
+
+var (
+	infrastructureGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Infrastructure"}
+	clusterVersionGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "ClusterVersion"}
+	networkGVK        = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Network"}
+	poolListGVK       = schema.GroupVersionKind{Group: "machineconfiguration.openshift.io", Version: "v1", Kind: "MachineConfigPoolList"}
+)
+
+// GetPlatformType returns the platform type of the cluster, e.g. "BareMetal" or "AWS",
+// as reported by the status of the Infrastructure/cluster resource.
+func GetPlatformType(ctx context.Context, cs *client.ClientSet) (string, error) {
+	infra, err := getInfrastructure(ctx, cs)
+	if err != nil {
+		return "", err
+	}
+
+	platformType, found, err := unstructured.NestedString(infra.Object, "status", "platformStatus", "type")
+	if err != nil {
+		return "", fmt.Errorf("failed reading the platform type of Infrastructure/%s: %w", clusterResourceName, err)
+	}
+
+	if !found || platformType == "" {
+		// status.platform is deprecated in favor of status.platformStatus.type,
+		// but is the only one set on clusters installed before 4.2.
+		platformType, _, err = unstructured.NestedString(infra.Object, "status", "platform")
+		if err != nil || platformType == "" {
+			return "", fmt.Errorf("platform type is not set in Infrastructure/%s", clusterResourceName)
+		}
+	}
+
+	return platformType, nil
+}
+
+func getInfrastructure(ctx context.Context, cs *client.ClientSet) (*unstructured.Unstructured, error) {
+	infra := &unstructured.Unstructured{}
+	infra.SetGroupVersionKind(infrastructureGVK)
+
+	err := cs.Get(ctx, rtclient.ObjectKey{Name: clusterResourceName}, infra)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting Infrastructure/%s: %w", clusterResourceName, err)
+	}
+
+	return infra, nil
+}
+
+// GetTopology returns the control plane and infrastructure topologies of the cluster,
+// e.g. "HighlyAvailable" or "SingleReplica", as reported by the status of the
+// Infrastructure/cluster resource.
+func GetTopology(ctx context.Context, cs *client.ClientSet) (controlPlane string, infrastructure string, err error) {
+	infra, err := getInfrastructure(ctx, cs)
+	if err != nil {
+		return "", "", err
+	}
+
+	controlPlane, _, err = unstructured.NestedString(infra.Object, "status", "controlPlaneTopology")
+	if err != nil {
+		return "", "", fmt.Errorf("failed reading the control plane topology of Infrastructure/%s: %w", clusterResourceName, err)
+	}
+
+	infrastructure, _, err = unstructured.NestedString(infra.Object, "status", "infrastructureTopology")
+	if err != nil {
+		return "", "", fmt.Errorf("failed reading the infrastructure topology of Infrastructure/%s: %w", clusterResourceName, err)
+	}
+
+	return controlPlane, infrastructure, nil
+}
+
+// GetVersion returns the version the cluster is at, e.g. "4.15.3", as reported
+// by the status of the ClusterVersion/version resource.
+func GetVersion(ctx context.Context, cs *client.ClientSet) (string, error) {
+	cv := &unstructured.Unstructured{}
+	cv.SetGroupVersionKind(clusterVersionGVK)
+
+	err := cs.Get(ctx, rtclient.ObjectKey{Name: clusterVersionResourceName}, cv)
+	if err != nil {
+		return "", fmt.Errorf("failed getting ClusterVersion/%s: %w", clusterVersionResourceName, err)
+	}
+
+	return parseVersion(cv)
+}
+
+// parseVersion returns the version of the newest completed update in the
+// history of the ClusterVersion, newest first, as the desired version is the
+// one being updated to during an update. It falls back to the desired version
+// when no update completed yet, e.g. during the installation.
+func parseVersion(cv *unstructured.Unstructured) (string, error) {
+	history, _, err := unstructured.NestedSlice(cv.Object, "status", "history")
+	if err != nil {
+		return "", fmt.Errorf("failed reading the history of ClusterVersion/%s: %w", clusterVersionResourceName, err)
+	}
+
+	for _, entry := range history {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		state, _, _ := unstructured.NestedString(fields, "state")
+		version, _, _ := unstructured.NestedString(fields, "version")
+		if state == completedState && version != "" {
+			return version, nil
+		}
+	}
+
+	version, found, err := unstructured.NestedString(cv.Object, "status", "desired", "version")
+	if err != nil || !found || version == "" {
+		return "", fmt.Errorf("version is not set in ClusterVersion/%s", clusterVersionResourceName)
+	}
+
+	return version, nil
+}
+
+// GetNetworks returns the pod and service networks of the cluster, as CIDRs,
+// as reported by the status of the Network/cluster resource.
+func GetNetworks(ctx context.Context, cs *client.ClientSet) (clusterNetworks []string, serviceNetworks []string, err error) {
+	network := &unstructured.Unstructured{}
+	network.SetGroupVersionKind(networkGVK)
+
+	err = cs.Get(ctx, rtclient.ObjectKey{Name: clusterResourceName}, network)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed getting Network/%s: %w", clusterResourceName, err)
+	}
+
+	entries, _, err := unstructured.NestedSlice(network.Object, "status", "clusterNetwork")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading the cluster networks of Network/%s: %w", clusterResourceName, err)
+	}
+	for _, entry := range entries {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		cidr, _, _ := unstructured.NestedString(fields, "cidr")
+		if cidr != "" {
+			clusterNetworks = append(clusterNetworks, cidr)
+		}
+	}
+
+	serviceNetworks, _, err = unstructured.NestedStringSlice(network.Object, "status", "serviceNetwork")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading the service networks of Network/%s: %w", clusterResourceName, err)
+	}
+
+	return clusterNetworks, serviceNetworks, nil
+}
+
+// GetMachineNetworks returns the networks of the nodes, as CIDRs, as set in
+// the install-config of the cluster-config-v1 ConfigMap.
+func GetMachineNetworks(ctx context.Context, cs *client.ClientSet) ([]string, error) {
+	cm, err := cs.ConfigMaps(clusterConfigNamespace).Get(ctx, clusterConfigName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed getting ConfigMap %s/%s: %w", clusterConfigNamespace, clusterConfigName, err)
+	}
+
+	raw, ok := cm.Data[installConfigKey]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found in ConfigMap %s/%s", installConfigKey, clusterConfigNamespace, clusterConfigName)
+	}
+
+	return parseMachineNetworks([]byte(raw))
+}
+
+// installConfig holds the fields of the install-config read by GetMachineNetworks.
+type installConfig struct {
+	Networking struct {
+		MachineNetwork []struct {
+			CIDR string `json:"cidr"`
+		} `json:"machineNetwork"`
+		// MachineCIDR is the deprecated single machine network.
+		MachineCIDR string `json:"machineCIDR"`
+	} `json:"networking"`
+}
+
+func parseMachineNetworks(raw []byte) ([]string, error) {
+	var config installConfig
+	if err := yaml.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the %s: %w", installConfigKey, err)
+	}
+
+	res := []string{}
+	for _, network := range config.Networking.MachineNetwork {
+		res = append(res, network.CIDR)
+	}
+	if len(res) == 0 && config.Networking.MachineCIDR != "" {
+		res = append(res, config.Networking.MachineCIDR)
+	}
+
+	return res, nil
+}
+
+// GetMachineConfigPools returns the MachineConfigPools of the cluster, with the
+// node selectors set in their specs.
+func GetMachineConfigPools(ctx context.Context, cs *client.ClientSet) ([]nodes.Pool, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(poolListGVK)
+
+	err := cs.List(ctx, list)
+	if err != nil {
+		return nil, fmt.Errorf("failed listing MachineConfigPools: %w", err)
+	}
+
+	res := []nodes.Pool{}
+	for _, item := range list.Items {
+		pool, err := parsePool(&item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, pool)
+	}
+
+	return res, nil
+}
+
+func parsePool(pool *unstructured.Unstructured) (nodes.Pool, error) {
+	res := nodes.Pool{Name: pool.GetName()}
+
+	raw, found, err := unstructured.NestedMap(pool.Object, "spec", "nodeSelector")
+	if err != nil {
+		return res, fmt.Errorf("failed reading the node selector of MachineConfigPool/%s: %w", res.Name, err)
+	}
+	if !found {
+		// A pool without a node selector selects no nodes.
+		return res, nil
+	}
+
+	labelSelector := &metav1.LabelSelector{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(raw, labelSelector)
+	if err != nil {
+		return res, fmt.Errorf("failed converting the node selector of MachineConfigPool/%s: %w", res.Name, err)
+	}
+
+	res.NodeSelector, err = metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return res, fmt.Errorf("invalid node selector of MachineConfigPool/%s: %w", res.Name, err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,56 @@
+package clusterconfig
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseVersion(t *testing.T) {
+	desired := map[string]interface{}{"version": "4.15.3"}
+	tests := []struct {
+		desc     string
+		history  []interface{}
+		expected string
+	}{
+		{
+			desc: "updating",
+			history: []interface{}{
+				map[string]interface{}{"state": "Partial", "version": "4.15.3"},
+				map[string]interface{}{"state": "Completed", "version": "4.14.10"},
+				map[string]interface{}{"state": "Completed", "version": "4.14.1"},
+			},
+			expected: "4.14.10",
+		},
+		{
+			desc: "failed-update",
+			history: []interface{}{
+				map[string]interface{}{"state": "Partial", "version": "4.15.3"},
+				map[string]interface{}{"state": "Partial", "version": "4.15.2"},
+				map[string]interface{}{"state": "Completed", "version": "4.14.10"},
+			},
+			expected: "4.14.10",
+		},
+		{
+			desc:     "installing",
+			history:  []interface{}{map[string]interface{}{"state": "Partial", "version": "4.15.3"}},
+			expected: "4.15.3",
+		},
+	}
+	for _, test := range tests {
+		cv := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"desired": desired, "history": test.history},
+		}}
+		res, err := parseVersion(cv)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.desc, err)
+		}
+		if res != test.expected {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+	}
+
+	if _, err := parseVersion(&unstructured.Unstructured{Object: map[string]interface{}{}}); err == nil {
+		t.Fatalf("test no-version failed. expected an error")
+	}
+}
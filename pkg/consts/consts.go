@@ -3,11 +3,14 @@ package consts
 const (
 	DefaultAddressType    = "IPv4"
 	IngressLabel          = "ingress"
+	EgressLabel           = "egress"
 	OptionalLabel         = "optional"
 	OptionalTrue          = "true"
 	PlaceHolderIPAddress  = "1.1.1.1"
 	TestNameSpace         = "test-node-comm"
 	RoleLabel             = "node-role.kubernetes.io/"
+	MasterRole            = "master"
+	WorkerRole            = "worker"
 	DefaultDebugNamespace = "openshift-commatrix-debug"
 	DefaultDebugPodImage  = "quay.io/openshift-release-dev/ocp-v4.0-art-dev@sha256:535ce24b5f1894d2a07bfa7eed7ad028ffde0659693f2a571ac4712a21cd028c"
 )
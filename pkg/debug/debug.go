@@ -9,6 +9,7 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/utils/ptr"
@@ -20,39 +21,55 @@ type DebugPod struct {
 	Name      string
 	Namespace string
 	NodeName  string
+
+	clientSet *client.ClientSet
+	// createdNamespace is true if the namespace was created for the pod,
+	// and is deleted along with it.
+	createdNamespace bool
 }
 
 const (
 	interval = 1 * time.Second
 	timeout  = 30 * time.Second
+	// cleanTimeout bounds the deletion of the debug resources, which runs
+	// regardless of the cancellation of the caller context.
+	cleanTimeout = 2 * time.Minute
 )
 
 // New creates debug pod on the given node, puts it in infinite sleep,
 // and returns the DebugPod object. Use the Clean() method to delete it.
-func New(cs *client.ClientSet, node string, namespace string, image string) (*DebugPod, error) {
+// If ctx is cancelled while the pod is being created, or it fails to run,
+// the created resources are deleted. The namespace is created if missing,
+// and only deleted if it was.
+func New(ctx context.Context, cs *client.ClientSet, node string, namespace string, image string) (*DebugPod, error) {
 	if namespace == "" {
 		return nil, errors.New("failed creating new debug pod: got empty namespace")
 	}
 
-	err := createNamespace(cs, namespace)
+	created, err := createNamespace(ctx, cs, namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	pod, err := createPodAndWait(cs, interval, timeout, node, namespace, image)
+	dp := &DebugPod{Namespace: namespace, NodeName: node, clientSet: cs, createdNamespace: created}
+	pod, err := createPodAndWait(ctx, cs, interval, timeout, node, namespace, image)
+	if pod != nil {
+		dp.Name = pod.Name
+	}
 	if err != nil {
+		if cleanErr := dp.Clean(); cleanErr != nil {
+			return nil, errors.Join(err, cleanErr)
+		}
+
 		return nil, err
 	}
 
-	return &DebugPod{
-		Name:      pod.Name,
-		Namespace: namespace,
-		NodeName:  node}, nil
+	return dp, nil
 }
 
-func (dp *DebugPod) Exec(cmd string) ([]byte, error) {
+func (dp *DebugPod) Exec(ctx context.Context, cmd string) ([]byte, error) {
 	cmdOnDebugPod := append([]string{"exec", "-n", dp.Namespace, dp.Name, "--", "chroot", "/host"}, strings.Split(cmd, " ")...)
-	out, err := exec.Command("oc", cmdOnDebugPod...).CombinedOutput()
+	out, err := exec.CommandContext(ctx, "oc", cmdOnDebugPod...).CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("failed to exec command \"%s\" on node %s: %v\n%s", cmd, dp.NodeName, err, string(out))
 	}
@@ -60,12 +77,12 @@ func (dp *DebugPod) Exec(cmd string) ([]byte, error) {
 	return out, nil
 }
 
-func (dp *DebugPod) ExecWithRetry(cmd string, interval time.Duration, duration time.Duration) ([]byte, error) {
+func (dp *DebugPod) ExecWithRetry(ctx context.Context, cmd string, interval time.Duration, duration time.Duration) ([]byte, error) {
 	out := []byte{}
 	execErr := errors.New("")
 
-	if err := wait.PollUntilContextTimeout(context.TODO(), interval, duration, true, func(ctx context.Context) (bool, error) {
-		out, execErr = dp.Exec(cmd)
+	if err := wait.PollUntilContextTimeout(ctx, interval, duration, true, func(ctx context.Context) (bool, error) {
+		out, execErr = dp.Exec(ctx, cmd)
 		if execErr != nil {
 			return false, execErr
 		}
@@ -78,16 +95,28 @@ func (dp *DebugPod) ExecWithRetry(cmd string, interval time.Duration, duration t
 	return out, nil
 }
 
-// Clean deletes the debug pod and his namespace.
+// Clean deletes the debug pod, and its namespace if it was created for it,
+// waiting for the namespace to be deleted so the debug pod of the next node
+// can create it again. It does not take the caller context, so the resources
+// are deleted even after it was cancelled.
 func (dp *DebugPod) Clean() error {
-	output, err := exec.Command("oc", "delete", "pod", "-n", dp.Namespace, dp.Name).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed deleting debug pod %s/%s: %v\n%s", dp.Namespace, dp.Name, err, string(output))
+	ctx, cancel := context.WithTimeout(context.Background(), cleanTimeout)
+	defer cancel()
+
+	if dp.Name != "" {
+		err := dp.clientSet.Pods(dp.Namespace).Delete(ctx, dp.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed deleting debug pod %s/%s: %w", dp.Namespace, dp.Name, err)
+		}
 	}
 
-	output, err = exec.Command("oc", "delete", "ns", dp.Namespace).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed deleting debug namespace %s: %v\n%s", dp.Namespace, err, string(output))
+	if dp.createdNamespace {
+		err := dp.clientSet.Namespaces().Delete(ctx, dp.Namespace, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed deleting debug namespace %s: %w", dp.Namespace, err)
+		}
+
+		return waitNamespaceDeleted(ctx, dp.clientSet, dp.Namespace)
 	}
 
 	return nil
@@ -97,24 +126,26 @@ func (dp *DebugPod) String() string {
 	return fmt.Sprintf(dp.Name)
 }
 
-func createPodAndWait(cs *client.ClientSet, interval time.Duration, timeout time.Duration, node string, namespace string, image string) (*corev1.Pod, error) {
-	pod, err := createPod(cs, node, namespace, image)
+// createPodAndWait creates the debug pod and waits for it to run. The pod is
+// returned along with the error if it was created but failed to run.
+func createPodAndWait(ctx context.Context, cs *client.ClientSet, interval time.Duration, timeout time.Duration, node string, namespace string, image string) (*corev1.Pod, error) {
+	pod, err := createPod(ctx, cs, node, namespace, image)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create debug pod: %w", err)
 	}
 
-	err = waitPodPhase(cs, interval, timeout, pod, corev1.PodRunning)
+	err = waitPodPhase(ctx, cs, interval, timeout, pod, corev1.PodRunning)
 	if err != nil {
-		return nil, fmt.Errorf("failed waiting for debug pod to be ready: %w", err)
+		return pod, fmt.Errorf("failed waiting for debug pod to be ready: %w", err)
 	}
 
 	return pod, nil
 }
 
-func waitPodPhase(cs *client.ClientSet, interval time.Duration, timeout time.Duration, pod *corev1.Pod, phase corev1.PodPhase) error {
+func waitPodPhase(ctx context.Context, cs *client.ClientSet, interval time.Duration, timeout time.Duration, pod *corev1.Pod, phase corev1.PodPhase) error {
 	getErr := errors.New("")
-	err := wait.PollUntilContextTimeout(context.TODO(), interval, timeout, true, func(ctx context.Context) (bool, error) {
-		pod, getErr := cs.Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		pod, getErr := cs.Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
 		if getErr != nil && errors.Is(getErr, exec.ErrNotFound) {
 			return false, getErr
 		}
@@ -137,13 +168,13 @@ func waitPodPhase(cs *client.ClientSet, interval time.Duration, timeout time.Dur
 	return nil
 }
 
-func createPod(cs *client.ClientSet, node string, namespace string, image string) (*corev1.Pod, error) {
-	defaultDockerCfgServiceName, err := getSecret(cs, namespace, "default-dockercfg")
+func createPod(ctx context.Context, cs *client.ClientSet, node string, namespace string, image string) (*corev1.Pod, error) {
+	defaultDockerCfgServiceName, err := getSecret(ctx, cs, namespace, "default-dockercfg")
 	if err != nil {
 		return nil, err
 	}
 	podDef := getPodDefinition(node, namespace, defaultDockerCfgServiceName.Name, image)
-	pod, err := cs.Pods(namespace).Create(context.TODO(), podDef, metav1.CreateOptions{})
+	pod, err := cs.Pods(namespace).Create(ctx, podDef, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -298,8 +329,8 @@ func getPodDefinition(node string, namespace string, secret string, image string
 	}
 }
 
-func getSecret(cs *client.ClientSet, namespace string, secretName string) (*corev1.Secret, error) {
-	secretList, err := cs.Secrets(namespace).List(context.TODO(), metav1.ListOptions{})
+func getSecret(ctx context.Context, cs *client.ClientSet, namespace string, secretName string) (*corev1.Secret, error) {
+	secretList, err := cs.Secrets(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -313,21 +344,46 @@ func getSecret(cs *client.ClientSet, namespace string, secretName string) (*core
 	return nil, fmt.Errorf("failed to get secret %s in namespace %s: not found", secretName, namespace)
 }
 
-func createNamespace(cs *client.ClientSet, namespace string) error {
-	_, err := cs.Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
-	if err != nil && !strings.Contains(err.Error(), "not found") {
-		return fmt.Errorf("failed checking if namespace %s already exists: %v", namespace, err)
+// createNamespace creates the namespace if missing, and returns true if it
+// was created. A namespace being deleted is waited for and created again.
+func createNamespace(ctx context.Context, cs *client.ClientSet, namespace string) (bool, error) {
+	existing, err := cs.Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	switch {
+	case err == nil && existing.DeletionTimestamp == nil:
+		return false, nil
+	case err == nil:
+		// No pods can be created in a Terminating namespace, e.g. one left
+		// by an interrupted run.
+		if err := waitNamespaceDeleted(ctx, cs, namespace); err != nil {
+			return false, err
+		}
+	case !apierrors.IsNotFound(err):
+		return false, fmt.Errorf("failed checking if namespace %s already exists: %v", namespace, err)
 	}
 
-	if err == nil {
-		return nil
+	ns := getNamespaceDefinition(namespace)
+
+	_, err = cs.Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed creating namespace %s: %v", namespace, err)
 	}
 
-	ns := getNamespaceDefinition(namespace)
+	return true, nil
+}
+
+// waitNamespaceDeleted waits for the namespace to be deleted. Namespaces are
+// deleted asynchronously, staying Terminating until their resources are.
+func waitNamespaceDeleted(ctx context.Context, cs *client.ClientSet, namespace string) error {
+	err := wait.PollUntilContextTimeout(ctx, interval, cleanTimeout, true, func(ctx context.Context) (bool, error) {
+		_, err := cs.Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
 
-	_, err = cs.Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+		return false, err
+	})
 	if err != nil {
-		return fmt.Errorf("failed creating namespace %s: %v", namespace, err)
+		return fmt.Errorf("failed waiting for namespace %s to be deleted: %w", namespace, err)
 	}
 
 	return nil
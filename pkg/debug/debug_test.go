@@ -0,0 +1,128 @@
+package debug
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/liornoy/node-comm-lib/pkg/client"
+)
+
+const testNamespace = "commatrix-debug"
+
+func TestNewCleanup(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "default-dockercfg-abcde", Namespace: testNamespace}}
+
+	tests := []struct {
+		desc string
+		// objects exist before New runs.
+		objects []runtime.Object
+		// cancel cancels the context of New, so waiting for the pod fails.
+		cancel            bool
+		expectedNamespace bool
+	}{
+		// Without the pull secret the pod creation fails.
+		{desc: "failure-existing-namespace", objects: []runtime.Object{namespace}, expectedNamespace: true},
+		{desc: "failure-created-namespace", expectedNamespace: false},
+		{desc: "cancel-existing-namespace", objects: []runtime.Object{namespace, secret}, cancel: true, expectedNamespace: true},
+		{desc: "cancel-created-namespace", objects: []runtime.Object{secret}, cancel: true, expectedNamespace: false},
+	}
+	for _, test := range tests {
+		fakeClient := fake.NewSimpleClientset(test.objects...)
+		// The fake client does not generate names as the API server does.
+		fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+			pod.Name = pod.GenerateName + "abcde"
+			return false, nil, nil
+		})
+		cs := &client.ClientSet{CoreV1Interface: fakeClient.CoreV1()}
+		ctx, cancel := context.WithCancel(context.Background())
+		if test.cancel {
+			cancel()
+		}
+
+		dp, err := New(ctx, cs, "worker-0", testNamespace, "image")
+		cancel()
+		if err == nil || dp != nil {
+			t.Fatalf("test %s failed. expected an error got %v", test.desc, dp)
+		}
+
+		pods, err := cs.Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.desc, err)
+		}
+		if len(pods.Items) != 0 {
+			t.Fatalf("test %s failed. expected the debug pod to be deleted got %v", test.desc, pods.Items)
+		}
+
+		_, err = cs.Namespaces().Get(context.Background(), testNamespace, metav1.GetOptions{})
+		if exists := err == nil; exists != test.expectedNamespace {
+			t.Fatalf("test %s failed. expected namespace to exist %v got %v", test.desc, test.expectedNamespace, exists)
+		}
+	}
+}
+
+func TestNewCleanNodes(t *testing.T) {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "default-dockercfg-abcde", Namespace: testNamespace}}
+	fakeClient := fake.NewSimpleClientset(secret)
+	namespaces := corev1.SchemeGroupVersion.WithResource("namespaces")
+
+	// As the API server does, deleted namespaces stay Terminating for a while,
+	// here until read twice, and pods can't be created in them meanwhile.
+	terminatingGets := 0
+	fakeClient.PrependReactor("delete", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, err := fakeClient.Tracker().Get(namespaces, "", action.(k8stesting.DeleteAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		ns := obj.(*corev1.Namespace)
+		ns.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		terminatingGets = 2
+		return true, nil, fakeClient.Tracker().Update(namespaces, ns, "")
+	})
+	fakeClient.PrependReactor("get", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if terminatingGets == 0 {
+			return false, nil, nil
+		}
+		terminatingGets--
+		if terminatingGets == 0 {
+			return false, nil, fakeClient.Tracker().Delete(namespaces, "", action.(k8stesting.GetAction).GetName())
+		}
+		return false, nil, nil
+	})
+	fakeClient.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if terminatingGets > 0 {
+			return true, nil, apierrors.NewForbidden(corev1.Resource("pods"), "", nil)
+		}
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Name = pod.GenerateName + "abcde"
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+	cs := &client.ClientSet{CoreV1Interface: fakeClient.CoreV1()}
+
+	for _, node := range []string{"worker-0", "worker-1"} {
+		dp, err := New(context.Background(), cs, node, testNamespace, "image")
+		if err != nil {
+			t.Fatalf("test %s failed: %v", node, err)
+		}
+		if !dp.createdNamespace {
+			t.Fatalf("test %s failed. expected the namespace to be created", node)
+		}
+
+		if err := dp.Clean(); err != nil {
+			t.Fatalf("test %s failed: %v", node, err)
+		}
+		if _, err := cs.Namespaces().Get(context.Background(), testNamespace, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+			t.Fatalf("test %s failed. expected the namespace to be deleted got %v", node, err)
+		}
+	}
+}
@@ -23,26 +23,26 @@ type EndpointSlicesInfo struct {
 	Pods          []corev1.Pod
 }
 
-func GetIngressEndpointSlicesInfo(cs *client.ClientSet) ([]EndpointSlicesInfo, error) {
+func GetIngressEndpointSlicesInfo(ctx context.Context, cs *client.ClientSet) ([]EndpointSlicesInfo, error) {
 	var (
 		epSlicesList discoveryv1.EndpointSliceList
 		servicesList corev1.ServiceList
 		podsList     corev1.PodList
 	)
 
-	err := cs.List(context.TODO(), &epSlicesList, &rtclient.ListOptions{})
+	err := cs.List(ctx, &epSlicesList, &rtclient.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list endpointslices: %w", err)
 	}
 	log.Debugf("amount of EndpointSlices in the cluster: %d", len(epSlicesList.Items))
 
-	err = cs.List(context.TODO(), &servicesList, &rtclient.ListOptions{})
+	err = cs.List(ctx, &servicesList, &rtclient.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list services: %w", err)
 	}
 	log.Debugf("amount of Services in the cluster: %d", len(servicesList.Items))
 
-	err = cs.List(context.TODO(), &podsList, &rtclient.ListOptions{})
+	err = cs.List(ctx, &podsList, &rtclient.ListOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list pods: %w", err)
 	}
@@ -59,15 +59,31 @@ func GetIngressEndpointSlicesInfo(cs *client.ClientSet) ([]EndpointSlicesInfo, e
 	return res, nil
 }
 
-func ToComDetails(cs *client.ClientSet, epSlicesInfo []EndpointSlicesInfo) ([]types.ComDetails, error) {
+// Options configures the entries created from the EndpointSlices.
+type Options struct {
+	// PerNode creates an entry per node the endpoints are on, rather than per
+	// node role.
+	PerNode bool
+	// Roles selects the node roles entries are created for.
+	Roles nodesutil.RoleSelector
+}
+
+// ToComDetails returns the entries of the EndpointSlices, per node role.
+func ToComDetails(ctx context.Context, cs *client.ClientSet, epSlicesInfo []EndpointSlicesInfo) ([]types.ComDetails, error) {
+	return ToComDetailsWithOptions(ctx, cs, epSlicesInfo, Options{})
+}
+
+// ToComDetailsWithOptions returns the entries of the EndpointSlices, per node
+// role or per node, as configured by opts.
+func ToComDetailsWithOptions(ctx context.Context, cs *client.ClientSet, epSlicesInfo []EndpointSlicesInfo, opts Options) ([]types.ComDetails, error) {
 	comDetails := make([]types.ComDetails, 0)
-	nodeList, err := cs.Nodes().List(context.TODO(), metav1.ListOptions{})
+	nodeList, err := cs.Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	for _, epSliceInfo := range epSlicesInfo {
-		cds, err := epSliceInfo.toComDetails(nodeList.Items)
+		cds, err := epSliceInfo.toComDetails(nodeList.Items, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -75,7 +91,7 @@ func ToComDetails(cs *client.ClientSet, epSlicesInfo []EndpointSlicesInfo) ([]ty
 		comDetails = append(comDetails, cds...)
 	}
 
-	cleanedComDetails := removeDups(comDetails)
+	cleanedComDetails := types.RemoveDups(mergeAddressFamilies(comDetails))
 	return cleanedComDetails, nil
 }
 
@@ -149,26 +165,60 @@ func getService(name, namespace string, serviceList *corev1.ServiceList) (*corev
 }
 
 // getEndpointSliceNodeRoles gets endpointslice Info struct and returns which node roles the services are on.
-func getEndpointSliceNodeRoles(epSliceInfo *EndpointSlicesInfo, nodes []corev1.Node) []string {
-	// map to prevent duplications
-	rolesMap := make(map[string]bool)
+func getEndpointSliceNodeRoles(epSliceInfo *EndpointSlicesInfo, nodes []corev1.Node, selector nodesutil.RoleSelector) []string {
+	// set to prevent duplications
+	roles := sets.New[string]()
 	for _, endpoint := range epSliceInfo.EndpointSlice.Endpoints {
 		nodeName := endpoint.NodeName
-		for _, node := range nodes {
-			if node.Name == *nodeName {
-				role := nodesutil.GetRoles(&node)
-				rolesMap[role] = true
-				log.Debug("found node, role is:", role)
+		for i := range nodes {
+			if nodeName != nil && nodes[i].Name == *nodeName {
+				nodeRoles := selector.Select(&nodes[i])
+				roles.Insert(nodeRoles...)
+				log.Debug("found node, roles are:", nodeRoles)
 			}
 		}
 	}
 
-	roles := []string{}
-	for k := range rolesMap {
-		roles = append(roles, k)
+	return sets.List(roles)
+}
+
+// nodeTarget is a node role, or a node of the role, entries are open on.
+type nodeTarget struct {
+	role string
+	name string
+}
+
+// getEndpointSliceNodeTargets returns the node roles the endpoints of the
+// EndpointSlice are on, or the nodes if opts.PerNode is set.
+func getEndpointSliceNodeTargets(epSliceInfo *EndpointSlicesInfo, nodes []corev1.Node, opts Options) []nodeTarget {
+	res := []nodeTarget{}
+	if !opts.PerNode {
+		for _, role := range getEndpointSliceNodeRoles(epSliceInfo, nodes, opts.Roles) {
+			res = append(res, nodeTarget{role: role})
+		}
+
+		return res
 	}
 
-	return roles
+	found := sets.New[string]()
+	for _, endpoint := range epSliceInfo.EndpointSlice.Endpoints {
+		if endpoint.NodeName == nil || found.Has(*endpoint.NodeName) {
+			continue
+		}
+
+		for i := range nodes {
+			if nodes[i].Name != *endpoint.NodeName {
+				continue
+			}
+
+			for _, role := range opts.Roles.Select(&nodes[i]) {
+				res = append(res, nodeTarget{role: role, name: nodes[i].Name})
+			}
+			found.Insert(nodes[i].Name)
+		}
+	}
+
+	return res
 }
 
 func getContainerName(portNum int, pods []corev1.Pod) (string, error) {
@@ -203,7 +253,7 @@ func getContainerName(portNum int, pods []corev1.Pod) (string, error) {
 	return res, nil
 }
 
-func (epSliceinfo *EndpointSlicesInfo) toComDetails(nodes []corev1.Node) ([]types.ComDetails, error) {
+func (epSliceinfo *EndpointSlicesInfo) toComDetails(nodes []corev1.Node, opts Options) ([]types.ComDetails, error) {
 	if len(epSliceinfo.EndpointSlice.OwnerReferences) == 0 {
 		return nil, fmt.Errorf("empty OwnerReferences in EndpointSlice %s/%s. skipping", epSliceinfo.EndpointSlice.Namespace, epSliceinfo.EndpointSlice.Name)
 	}
@@ -214,15 +264,16 @@ func (epSliceinfo *EndpointSlicesInfo) toComDetails(nodes []corev1.Node) ([]type
 	namespace := epSliceinfo.Serivce.Namespace
 	name := epSliceinfo.EndpointSlice.OwnerReferences[0].Name
 
-	// Get the node roles of this endpointslice. (master or worker or both).
-	roles := getEndpointSliceNodeRoles(epSliceinfo, nodes)
+	// Get the node roles of this endpointslice (master or worker or both), or its nodes.
+	targets := getEndpointSliceNodeTargets(epSliceinfo, nodes, opts)
 
 	epSlice := epSliceinfo.EndpointSlice
 
 	optional := isOptional(epSlice)
 	service := epSlice.Labels["kubernetes.io/service-name"]
+	family := addressFamily(epSlice.AddressType)
 
-	for _, role := range roles {
+	for _, target := range targets {
 		for _, port := range epSlice.Ports {
 			containerName, err := getContainerName(int(*port.Port), epSliceinfo.Pods)
 			if err != nil {
@@ -231,15 +282,17 @@ func (epSliceinfo *EndpointSlicesInfo) toComDetails(nodes []corev1.Node) ([]type
 			}
 
 			res = append(res, types.ComDetails{
-				Direction: consts.IngressLabel,
-				Protocol:  string(*port.Protocol),
-				Port:      fmt.Sprint(int(*port.Port)),
-				Namespace: namespace,
-				Pod:       name,
-				Container: containerName,
-				NodeRole:  role,
-				Service:   service,
-				Optional:  optional,
+				Direction:     consts.IngressLabel,
+				Protocol:      types.Protocol(*port.Protocol),
+				Port:          types.SinglePort(int(*port.Port)),
+				Namespace:     namespace,
+				Pod:           name,
+				Container:     containerName,
+				NodeRole:      target.role,
+				NodeName:      target.name,
+				Service:       service,
+				Optional:      optional,
+				AddressFamily: family,
 			})
 		}
 	}
@@ -256,9 +309,47 @@ func isOptional(epSlice discoveryv1.EndpointSlice) bool {
 	return optional
 }
 
-func removeDups(comDetails []types.ComDetails) []types.ComDetails {
+// addressFamily returns the address family of the endpoints of an EndpointSlice
+// address type, or no family for FQDN endpoints.
+func addressFamily(addressType discoveryv1.AddressType) types.AddressFamily {
+	switch addressType {
+	case discoveryv1.AddressTypeIPv4:
+		return types.IPv4
+	case discoveryv1.AddressTypeIPv6:
+		return types.IPv6
+	default:
+		return ""
+	}
+}
+
+// mergeAddressFamilies replaces the entries found in both the IPv4 and the IPv6
+// EndpointSlices of a dual-stack service with a single entry of both families.
+func mergeAddressFamilies(comDetails []types.ComDetails) []types.ComDetails {
 	set := sets.New[types.ComDetails](comDetails...)
-	res := set.UnsortedList()
+	res := make([]types.ComDetails, 0, len(comDetails))
+	for _, cd := range comDetails {
+		other := cd
+		switch cd.AddressFamily {
+		case types.IPv4:
+			other.AddressFamily = types.IPv6
+		case types.IPv6:
+			other.AddressFamily = types.IPv4
+		default:
+			res = append(res, cd)
+			continue
+		}
+
+		if !set.Has(other) {
+			res = append(res, cd)
+			continue
+		}
+
+		// Keep the entry of both families in place of the IPv4 one.
+		if cd.AddressFamily == types.IPv4 {
+			cd.AddressFamily = ""
+			res = append(res, cd)
+		}
+	}
 
 	return res
 }
@@ -1,27 +1,58 @@
 package nftables
 
 type Data struct {
-	AllowedTCPPorts []string
-	AllowedUDPPorts []string
+	Rules []Rule
+	// EgressRules are the rules of the output chain, which is only written
+	// if there are egress rules.
+	EgressRules []Rule
+	// DropEgress sets the policy of the output chain to drop, rather than
+	// accept, so only the egress rules are allowed.
+	DropEgress bool
 }
 
-const Template = `
-table ip my_filter {
+// Rule accepts traffic to a set of ports.
+type Rule struct {
+	// Family is the nfproto the rule is restricted to, ipv4 or ipv6, or empty
+	// for both.
+	Family   string
+	Protocol string
+	Ports    []string
+	// Saddr and Daddr are the source and destination IP address or CIDR the
+	// rule is restricted to, of the rule family.
+	Saddr string
+	Daddr string
+	// Comment is added to the rule, e.g. to explain why it is wider than
+	// its entries.
+	Comment string
+}
+
+const Template = `{{define "ip"}}{{if eq .Family "ipv6"}}ip6{{else}}ip{{end}}{{end}}` +
+	`{{define "rule"}}{{if .Saddr}}{{template "ip" .}} saddr {{.Saddr}} {{end}}{{if .Daddr}}{{template "ip" .}} daddr {{.Daddr}} {{end}}` +
+	`{{if and .Family (not .Saddr) (not .Daddr)}}meta nfproto {{.Family}} {{end}}` +
+	`{{.Protocol}} dport { {{range .Ports}}{{.}}, {{end}} } accept{{if .Comment}} comment "{{.Comment}}"{{end}};{{end}}
+table inet my_filter {
     chain input {
         type filter hook input priority 0; policy drop;
 
         iifname "lo" accept;
+        ct state established,related accept;
 
         # Hard-coded rule to allow SSH traffic for safety
         tcp dport 22 accept;
-		
-		{{if (len .AllowedTCPPorts) gt 0}}
-        tcp dport { {{range .AllowedTCPPorts}}{{.}}, {{end}} } accept;
+		{{range .Rules}}
+        {{template "rule" .}}
 		{{end}}
+    }
+	{{if gt (len .EgressRules) 0}}
+    chain output {
+        type filter hook output priority 0; policy {{if .DropEgress}}drop{{else}}accept{{end}};
 
-		{{if (len .AllowedUDPPorts) gt 0}}
-        udp dport { {{range .AllowedUDPPorts}}{{.}}, {{end}} } accept;
+        oifname "lo" accept;
+        ct state established,related accept;
+		{{range .EgressRules}}
+        {{template "rule" .}}
 		{{end}}
     }
+	{{end}}
 }
 `
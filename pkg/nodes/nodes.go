@@ -1,29 +1,129 @@
 package nodes
 
 import (
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/liornoy/node-comm-lib/pkg/consts"
 )
 
-func GetRoles(node *corev1.Node) string {
-	res := ""
-	// Filter out user-defined roles.
-	validRoles := map[string]bool{"worker": true, "master": true}
+// AnyRole matches, in RoleSelector.Roles, the roles not listed in it.
+const AnyRole = "*"
 
+// GetRoles returns all the roles the node is labeled with, sorted.
+func GetRoles(node *corev1.Node) []string {
+	res := []string{}
 	for label := range node.Labels {
 		// Look for node-role label and extract role.
-		if after, found := strings.CutPrefix(label, consts.RoleLabel); found {
-			if !validRoles[after] {
-				continue
+		if after, found := strings.CutPrefix(label, consts.RoleLabel); found && after != "" {
+			res = append(res, after)
+		}
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// HasRole returns true if the node is labeled with the given node role.
+func HasRole(node *corev1.Node, role string) bool {
+	_, ok := node.Labels[consts.RoleLabel+role]
+	return ok
+}
+
+// Pool is a MachineConfigPool, selecting the nodes its configuration is
+// rolled out to.
+type Pool struct {
+	Name         string
+	NodeSelector labels.Selector
+}
+
+// RoleSelector selects the roles of a node entries are created for.
+type RoleSelector struct {
+	// Roles are the allowed roles, in priority order. AnyRole allows the roles
+	// not listed, sorted, at its position. Only the master and worker roles
+	// are allowed when empty.
+	Roles []string
+	// All selects every allowed role of a node, rather than only its highest
+	// priority one.
+	All bool
+	// Pools, when set, groups the nodes by MachineConfigPool rather than by
+	// role: the role of a node is the name of its pool, and Roles and All are
+	// ignored.
+	Pools []Pool
+}
+
+// Select returns the roles of the node entries are created for.
+func (s RoleSelector) Select(node *corev1.Node) []string {
+	if len(s.Pools) > 0 {
+		return s.selectPool(node)
+	}
+
+	allowed := s.Roles
+	if len(allowed) == 0 {
+		allowed = []string{consts.MasterRole, consts.WorkerRole}
+	}
+
+	roles := GetRoles(node)
+	res := []string{}
+	for _, role := range allowed {
+		if role == AnyRole {
+			for _, r := range roles {
+				if !contains(allowed, r) {
+					res = append(res, r)
+				}
 			}
+			continue
+		}
 
-			res = after
-			break
+		if contains(roles, role) {
+			res = append(res, role)
 		}
 	}
 
+	if !s.All && len(res) > 1 {
+		return res[:1]
+	}
+
 	return res
 }
+
+// selectPool returns the name of the pool of the node, or none if no pool
+// selects it. As done by the machine config operator, the master pool takes
+// precedence over the other pools, and custom pools over the worker pool.
+func (s RoleSelector) selectPool(node *corev1.Node) []string {
+	matched := []string{}
+	for _, pool := range s.Pools {
+		if pool.NodeSelector != nil && pool.NodeSelector.Matches(labels.Set(node.Labels)) {
+			matched = append(matched, pool.Name)
+		}
+	}
+	sort.Strings(matched)
+
+	switch {
+	case len(matched) <= 1:
+		return matched
+	case contains(matched, consts.MasterRole):
+		return []string{consts.MasterRole}
+	}
+
+	for _, name := range matched {
+		if name != consts.WorkerRole {
+			return []string{name}
+		}
+	}
+
+	return matched[:1]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
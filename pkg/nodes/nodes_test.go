@@ -0,0 +1,48 @@
+package nodes
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestRoleSelector(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+		"node-role.kubernetes.io/worker":  "",
+		"node-role.kubernetes.io/infra":   "",
+		"node-role.kubernetes.io/storage": "",
+		"kubernetes.io/hostname":          "node-1",
+	}}}
+
+	master := Pool{Name: "master", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/master": ""})}
+	worker := Pool{Name: "worker", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/worker": ""})}
+	infra := Pool{Name: "infra", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/infra": ""})}
+
+	tests := []struct {
+		desc     string
+		selector RoleSelector
+		expected []string
+	}{
+		{desc: "default", selector: RoleSelector{}, expected: []string{"worker"}},
+		{desc: "priority", selector: RoleSelector{Roles: []string{"infra", "worker"}}, expected: []string{"infra"}},
+		{desc: "all", selector: RoleSelector{Roles: []string{"infra", "worker"}, All: true}, expected: []string{"infra", "worker"}},
+		{desc: "any", selector: RoleSelector{Roles: []string{"master", "worker", AnyRole}, All: true}, expected: []string{"worker", "infra", "storage"}},
+		{desc: "none", selector: RoleSelector{Roles: []string{"edge"}}, expected: []string{}},
+		{desc: "pool", selector: RoleSelector{Pools: []Pool{master, worker}}, expected: []string{"worker"}},
+		{desc: "custom-pool", selector: RoleSelector{Pools: []Pool{master, worker, infra}}, expected: []string{"infra"}},
+		{desc: "no-pool", selector: RoleSelector{Pools: []Pool{master}}, expected: []string{}},
+	}
+	for _, test := range tests {
+		res := test.selector.Select(node)
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+	}
+
+	if roles := GetRoles(node); !reflect.DeepEqual(roles, []string{"infra", "storage", "worker"}) {
+		t.Fatalf("test get-roles failed. expected %v got %v", []string{"infra", "storage", "worker"}, roles)
+	}
+}
@@ -1,11 +1,14 @@
 package ss
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 
 	"github.com/liornoy/node-comm-lib/pkg/client"
@@ -26,17 +29,27 @@ var (
 	// TcpSSFilterFn is a function variable in Go that filters entries from the 'ss' command output.
 	// It takes an entry from the 'ss' command output and returns true if the entry represents a TCP port in the listening state.
 	tcpSSFilterFn = func(s string) bool {
-		return strings.Contains(s, "127.0.0") || !strings.Contains(s, "LISTEN")
+		return isLoopback(s) || !strings.Contains(s, "LISTEN")
 	}
 	// UdpSSFilterFn is a function variable in Go that filters entries from the 'ss' command output.
 	// It takes an entry from the 'ss' command output and returns true if the entry represents a UDP port in the listening state.
 	udpSSFilterFn = func(s string) bool {
-		return strings.Contains(s, "127.0.0") || !strings.Contains(s, "ESTAB")
+		return isLoopback(s) || !strings.Contains(s, "ESTAB")
+	}
+	// SctpSSFilterFn filters entries from the 'ss' command output.
+	// It returns true if the entry does not represent an SCTP port in the listening state,
+	// including the lines listing the additional local addresses of multi-homed sockets.
+	sctpSSFilterFn = func(s string) bool {
+		return isLoopback(s) || !strings.Contains(s, "LISTEN") || strings.HasPrefix(strings.TrimSpace(s), "`-")
 	}
 )
 
-func CreateComDetailsFromNode(cs *client.ClientSet, node *corev1.Node) ([]types.ComDetails, error) {
-	debugPod, err := debug.New(cs, node.Name, consts.DefaultDebugNamespace, consts.DefaultDebugPodImage)
+// CreateComDetailsFromNode runs ss on the node through a debug pod and returns
+// the ports the node listens on, with the node name set, for each of the node
+// roles selected by roles. The debug pod is deleted when done, also when
+// ctx is cancelled.
+func CreateComDetailsFromNode(ctx context.Context, cs *client.ClientSet, node *corev1.Node, roles nodes.RoleSelector) ([]types.ComDetails, error) {
+	debugPod, err := debug.New(ctx, cs, node.Name, consts.DefaultDebugNamespace, consts.DefaultDebugPodImage)
 	if err != nil {
 		return nil, err
 	}
@@ -47,23 +60,35 @@ func CreateComDetailsFromNode(cs *client.ClientSet, node *corev1.Node) ([]types.
 		}
 	}()
 
-	ssOutTCP, err := debugPod.ExecWithRetry("ss -anplt", interval, duration)
+	ssOutTCP, err := debugPod.ExecWithRetry(ctx, "ss -anplt", interval, duration)
 	if err != nil {
 		return nil, err
 	}
-	ssOutUDP, err := debugPod.ExecWithRetry("ss -anplu", interval, duration)
+	ssOutUDP, err := debugPod.ExecWithRetry(ctx, "ss -anplu", interval, duration)
 	if err != nil {
 		return nil, err
 	}
+	// ss fails listing SCTP sockets on the nodes where the sctp kernel module
+	// isn't loaded, which means there are no SCTP listeners.
+	ssOutSCTP, err := debugPod.Exec(ctx, "ss -anplS")
+	if err != nil {
+		log.Warnf("failed listing the SCTP sockets of node %s, assuming there are none: %v", node.Name, err)
+		ssOutSCTP = nil
+	}
 
 	ssOutFilteredTCP := filterStrings(tcpSSFilterFn, splitByLines(ssOutTCP))
 	ssOutFilteredUDP := filterStrings(udpSSFilterFn, splitByLines(ssOutUDP))
+	ssOutFilteredSCTP := filterStrings(sctpSSFilterFn, splitByLines(ssOutSCTP))
 
-	tcpComDetails, err := toComDetails(ssOutFilteredTCP, "TCP", node)
+	tcpComDetails, err := toComDetails(ssOutFilteredTCP, types.ProtocolTCP, node, roles.Select(node))
+	if err != nil {
+		return nil, err
+	}
+	udpComDetails, err := toComDetails(ssOutFilteredUDP, types.ProtocolUDP, node, roles.Select(node))
 	if err != nil {
 		return nil, err
 	}
-	udpComDetails, err := toComDetails(ssOutFilteredUDP, "UDP", node)
+	sctpComDetails, err := toComDetails(ssOutFilteredSCTP, types.ProtocolSCTP, node, roles.Select(node))
 	if err != nil {
 		return nil, err
 	}
@@ -71,6 +96,7 @@ func CreateComDetailsFromNode(cs *client.ClientSet, node *corev1.Node) ([]types.
 	res := []types.ComDetails{}
 	res = append(res, udpComDetails...)
 	res = append(res, tcpComDetails...)
+	res = append(res, sctpComDetails...)
 
 	return res, nil
 }
@@ -80,9 +106,8 @@ func splitByLines(bytes []byte) []string {
 	return strings.Split(str, "\n")
 }
 
-func toComDetails(ssOutput []string, protocol string, node *corev1.Node) ([]types.ComDetails, error) {
+func toComDetails(ssOutput []string, protocol types.Protocol, node *corev1.Node, nodeRoles []string) ([]types.ComDetails, error) {
 	res := make([]types.ComDetails, 0)
-	nodeRoles := nodes.GetRoles(node)
 
 	for _, ssEntry := range ssOutput {
 		cd, err := parseComDetail(ssEntry)
@@ -90,9 +115,12 @@ func toComDetails(ssOutput []string, protocol string, node *corev1.Node) ([]type
 			return nil, err
 		}
 		cd.Protocol = protocol
-		cd.NodeRole = nodeRoles
+		cd.NodeName = node.Name
 		cd.Optional = false
-		res = append(res, *cd)
+		for _, role := range nodeRoles {
+			cd.NodeRole = role
+			res = append(res, *cd)
+		}
 	}
 
 	return res, nil
@@ -199,14 +227,26 @@ func parseComDetail(ssEntry string) (*types.ComDetails, error) {
 	}
 
 	fields := strings.Fields(ssEntry)
-	portIdx := strings.LastIndex(fields[localAddrPortFieldIdx], ":")
-	port := fields[localAddrPortFieldIdx][portIdx+1:]
+	if len(fields) <= localAddrPortFieldIdx {
+		return nil, fmt.Errorf("local address not found in the input string: %s", ssEntry)
+	}
+
+	host, portStr, err := splitLocalAddress(fields[localAddrPortFieldIdx])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the local address of %s: %w", ssEntry, err)
+	}
+
+	port, err := types.ParsePortRange(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the port of %s: %w", ssEntry, err)
+	}
 
 	return &types.ComDetails{
-		Direction: consts.IngressLabel,
-		Port:      port,
-		Service:   serviceName,
-		Optional:  false}, nil
+		Direction:     consts.IngressLabel,
+		Port:          port,
+		Service:       serviceName,
+		AddressFamily: addressFamily(host),
+		Optional:      false}, nil
 }
 
 func extractServiceName(ssEntry string) (string, error) {
@@ -222,3 +262,48 @@ func extractServiceName(ssEntry string) (string, error) {
 
 	return serviceName, nil
 }
+
+// splitLocalAddress splits a local address of the 'ss' command output, such as
+// 0.0.0.0:22, [::]:22, *:22 or 127.0.0.53%lo:53, to its host and port.
+func splitLocalAddress(addr string) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Drop the interface the socket is bound to.
+	host, _, _ = strings.Cut(host, "%")
+
+	return host, port, nil
+}
+
+// addressFamily returns the address family of a local address host, or no
+// family if the socket listens on both, i.e. the host is *.
+func addressFamily(host string) types.AddressFamily {
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return types.IPv4
+	default:
+		return types.IPv6
+	}
+}
+
+// isLoopback returns true if the entry of the 'ss' command output listens on
+// a loopback address, such as 127.0.0.1 or ::1.
+func isLoopback(ssEntry string) bool {
+	fields := strings.Fields(ssEntry)
+	if len(fields) <= localAddrPortFieldIdx {
+		return false
+	}
+
+	host, _, err := splitLocalAddress(fields[localAddrPortFieldIdx])
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
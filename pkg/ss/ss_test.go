@@ -0,0 +1,103 @@
+package ss
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/liornoy/node-comm-lib/pkg/nodes"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+func TestParseComDetail(t *testing.T) {
+	tests := []struct {
+		ssEntry  string
+		port     types.PortRange
+		family   types.AddressFamily
+		loopback bool
+	}{
+		{
+			ssEntry: `LISTEN 0      4096         0.0.0.0:22        0.0.0.0:*    users:(("sshd",pid=1,fd=3))`,
+			port:    types.SinglePort(22),
+			family:  types.IPv4,
+		},
+		{
+			ssEntry: `LISTEN 0      4096            [::]:22           [::]:*    users:(("sshd",pid=1,fd=4))`,
+			port:    types.SinglePort(22),
+			family:  types.IPv6,
+		},
+		{
+			ssEntry: `LISTEN 0      4096               *:9100            *:*    users:(("node_exporter",pid=2,fd=3))`,
+			port:    types.SinglePort(9100),
+		},
+		{
+			ssEntry:  `LISTEN 0      4096           [::1]:9099        [::]:*    users:(("cluster-version",pid=3,fd=7))`,
+			port:     types.SinglePort(9099),
+			family:   types.IPv6,
+			loopback: true,
+		},
+		{
+			ssEntry:  `UNCONN 0      0      127.0.0.53%lo:53        0.0.0.0:*    users:(("systemd-resolve",pid=4,fd=13))`,
+			port:     types.SinglePort(53),
+			family:   types.IPv4,
+			loopback: true,
+		},
+	}
+	for _, test := range tests {
+		cd, err := parseComDetail(test.ssEntry)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.ssEntry, err)
+		}
+		if cd.Port != test.port || cd.AddressFamily != test.family {
+			t.Fatalf("test %s failed. expected %s %s got %s %s", test.ssEntry, test.port, test.family, cd.Port, cd.AddressFamily)
+		}
+		if loopback := isLoopback(test.ssEntry); loopback != test.loopback {
+			t.Fatalf("test %s failed. expected loopback %v got %v", test.ssEntry, test.loopback, loopback)
+		}
+	}
+}
+
+func TestToComDetailsRoles(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "infra-1", Labels: map[string]string{
+		"node-role.kubernetes.io/worker": "",
+		"node-role.kubernetes.io/infra":  "",
+	}}}
+	ssOutput := []string{`LISTEN 0      4096               *:1936            *:*    users:(("haproxy",pid=1,fd=3))`}
+	master := nodes.Pool{Name: "master", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/master": ""})}
+	worker := nodes.Pool{Name: "worker", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/worker": ""})}
+	infra := nodes.Pool{Name: "infra", NodeSelector: labels.SelectorFromSet(labels.Set{"node-role.kubernetes.io/infra": ""})}
+
+	tests := []struct {
+		desc     string
+		selector nodes.RoleSelector
+		expected []string
+	}{
+		{desc: "default", selector: nodes.RoleSelector{}, expected: []string{"worker"}},
+		{desc: "priority", selector: nodes.RoleSelector{Roles: []string{"infra", "worker"}}, expected: []string{"infra"}},
+		{desc: "all", selector: nodes.RoleSelector{Roles: []string{"infra", "worker"}, All: true}, expected: []string{"infra", "worker"}},
+		{desc: "unselected", selector: nodes.RoleSelector{Roles: []string{"master"}}, expected: []string{}},
+		{desc: "pool", selector: nodes.RoleSelector{Pools: []nodes.Pool{master, worker}}, expected: []string{"worker"}},
+		{desc: "custom-pool", selector: nodes.RoleSelector{Roles: []string{"worker"}, Pools: []nodes.Pool{master, worker, infra}}, expected: []string{"infra"}},
+		{desc: "no-pool", selector: nodes.RoleSelector{Pools: []nodes.Pool{master}}, expected: []string{}},
+	}
+	for _, test := range tests {
+		res, err := toComDetails(ssOutput, types.ProtocolTCP, node, test.selector.Select(node))
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.desc, err)
+		}
+
+		roles := []string{}
+		for _, cd := range res {
+			if cd.NodeName != node.Name || cd.Port != types.SinglePort(1936) {
+				t.Fatalf("test %s failed. expected port 1936 of %s got %s", test.desc, node.Name, cd)
+			}
+			roles = append(roles, cd.NodeRole)
+		}
+		if !reflect.DeepEqual(roles, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, roles)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package types
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// field is a field of an entry, named by its JSON name.
+type field struct {
+	name  string
+	value func(cd ComDetails) string
+}
+
+// fields are the fields of an entry, in the order of the CSV columns.
+var fields = []field{
+	{"direction", func(cd ComDetails) string { return cd.Direction }},
+	{"protocol", func(cd ComDetails) string { return string(cd.Protocol) }},
+	{"port", func(cd ComDetails) string { return cd.Port.String() }},
+	{"namespace", func(cd ComDetails) string { return cd.Namespace }},
+	{"service", func(cd ComDetails) string { return cd.Service }},
+	{"pod", func(cd ComDetails) string { return cd.Pod }},
+	{"container", func(cd ComDetails) string { return cd.Container }},
+	{"nodeRole", func(cd ComDetails) string { return cd.NodeRole }},
+	{"optional", func(cd ComDetails) string { return strconv.FormatBool(cd.Optional) }},
+	{"addressFamily", func(cd ComDetails) string { return string(cd.AddressFamily) }},
+	{"destinationRole", func(cd ComDetails) string { return cd.DestinationRole }},
+	{"destination", func(cd ComDetails) string { return cd.Destination }},
+	{"sourceRole", func(cd ComDetails) string { return cd.SourceRole }},
+	{"sourceNetwork", func(cd ComDetails) string { return string(cd.SourceNetwork) }},
+	{"sourceCIDR", func(cd ComDetails) string { return cd.SourceCIDR }},
+	{"nodeName", func(cd ComDetails) string { return cd.NodeName }},
+}
+
+// fieldValues returns the values of the fields of the entry, in the order of
+// the CSV columns.
+func fieldValues(cd ComDetails) []string {
+	values := []string{}
+	for _, f := range fields {
+		values = append(values, f.value(cd))
+	}
+
+	return values
+}
+
+// FieldChange is a field with different values in two entries.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Change is an entry found in both matrices with different metadata.
+// Fields lists every changed field, including the fields of the entry
+// covered rather than equal in the key, e.g. a node name.
+type Change struct {
+	Old    ComDetails    `json:"old"`
+	New    ComDetails    `json:"new"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// Comparison is the difference between an old and a new matrix.
+type Comparison struct {
+	// Added are the entries, or their ports, found only in the new matrix.
+	Added []ComDetails `json:"added"`
+	// Removed are the entries, or their ports, found only in the old matrix.
+	Removed []ComDetails `json:"removed"`
+	// Changed are the entries of both matrices whose metadata changed.
+	Changed []Change `json:"changed"`
+	// Unchanged counts the entries of the old matrix found as is in the new one.
+	Unchanged int `json:"unchanged"`
+	// Key is the key the entries were compared by.
+	Key Key `json:"key"`
+}
+
+// Compare returns the difference between m and the newer other matrix. It is
+// CompareByKey with DefaultKey, whose metadata are the namespace, service,
+// pod, container and optional fields.
+func (m ComMatrix) Compare(other ComMatrix) Comparison {
+	return m.CompareByKey(other, DefaultKey)
+}
+
+// CompareByKey returns the difference between m and the newer other matrix.
+// The added and removed entries are the ones DiffByKey returns. Entries of
+// both matrices with equal key fields are changed if any other field differs.
+func (m ComMatrix) CompareByKey(other ComMatrix, key Key) Comparison {
+	res := Comparison{
+		Added:   other.DiffByKey(m, key).Matrix,
+		Removed: m.DiffByKey(other, key).Matrix,
+		Changed: []Change{},
+		Key:     key,
+	}
+
+	byIdentity := map[string][]ComDetails{}
+	for _, cd := range other.Matrix {
+		byIdentity[key.identity(cd)] = append(byIdentity[key.identity(cd)], cd)
+	}
+
+	for _, cd := range m.Matrix {
+		candidates := byIdentity[key.identity(cd)]
+		if len(candidates) == 0 {
+			// Entries found in other as part of other entries are unchanged.
+			if len(ComMatrix{Matrix: []ComDetails{cd}}.DiffByKey(other, key).Matrix) == 0 {
+				res.Unchanged++
+			}
+			continue
+		}
+
+		if containsEntry(candidates, cd) {
+			res.Unchanged++
+			continue
+		}
+
+		res.Changed = append(res.Changed, Change{Old: cd, New: candidates[0], Fields: fieldChanges(cd, candidates[0])})
+	}
+
+	return res
+}
+
+func containsEntry(comDetails []ComDetails, cd ComDetails) bool {
+	for _, other := range comDetails {
+		if other == cd {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fieldChanges(old, updated ComDetails) []FieldChange {
+	res := []FieldChange{}
+	for _, f := range fields {
+		if f.value(old) != f.value(updated) {
+			res = append(res, FieldChange{Field: f.name, Old: f.value(old), New: f.value(updated)})
+		}
+	}
+
+	return res
+}
+
+// IsEmpty returns true if no entry was added, removed or changed.
+func (c Comparison) IsEmpty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// String returns the removed entries prefixed with '-', the added entries
+// prefixed with '+' and the changed entries prefixed with '~', followed by
+// their changed fields.
+func (c Comparison) String() string {
+	var result strings.Builder
+	for _, cd := range c.Removed {
+		result.WriteString("-" + cd.String() + "\n")
+	}
+	for _, cd := range c.Added {
+		result.WriteString("+" + cd.String() + "\n")
+	}
+	for _, change := range c.Changed {
+		result.WriteString("~" + change.New.String() + " " + change.delta() + "\n")
+	}
+
+	return result.String()
+}
+
+// delta describes the changed fields, e.g. "service: old -> new".
+func (c Change) delta() string {
+	deltas := []string{}
+	for _, f := range c.Fields {
+		deltas = append(deltas, fmt.Sprintf("%s: %s -> %s", f.Field, f.Old, f.New))
+	}
+
+	return strings.Join(deltas, "; ")
+}
+
+// ToCSV returns the added, removed and changed entries, with a change column
+// set to added, removed or changed, and a delta column describing the changed
+// fields. Changed entries are written with their new fields.
+func (c Comparison) ToCSV() ([]byte, error) {
+	w := &bytes.Buffer{}
+	csvwriter := csv.NewWriter(w)
+
+	header := []string{"change"}
+	for _, f := range fields {
+		header = append(header, f.name)
+	}
+	header = append(header, "delta")
+
+	records := [][]string{header}
+	for _, cd := range c.Added {
+		records = append(records, comparisonRecord("added", cd, ""))
+	}
+	for _, cd := range c.Removed {
+		records = append(records, comparisonRecord("removed", cd, ""))
+	}
+	for _, change := range c.Changed {
+		records = append(records, comparisonRecord("changed", change.New, change.delta()))
+	}
+
+	err := csvwriter.WriteAll(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to CSV format: %w", err)
+	}
+
+	return w.Bytes(), nil
+}
+
+func comparisonRecord(change string, cd ComDetails, delta string) []string {
+	record := append([]string{change}, fieldValues(cd)...)
+
+	return append(record, delta)
+}
+
+func (c Comparison) ToJSON() ([]byte, error) {
+	out, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// ToMarkdown returns a summary of the comparison followed by tables of the
+// added, removed and changed entries, e.g. for reviewing a pull request.
+func (c Comparison) ToMarkdown() []byte {
+	var res bytes.Buffer
+	fmt.Fprintf(&res, "%d added, %d removed, %d changed, %d unchanged.\n", len(c.Added), len(c.Removed), len(c.Changed), c.Unchanged)
+
+	writeMarkdownEntries(&res, "Added", c.Added)
+	writeMarkdownEntries(&res, "Removed", c.Removed)
+
+	if len(c.Changed) > 0 {
+		fmt.Fprintf(&res, "\n### Changed\n\n| entry | field | old | new |\n| --- | --- | --- | --- |\n")
+		for _, change := range c.Changed {
+			for _, f := range change.Fields {
+				fmt.Fprintf(&res, "| %s | %s | %s | %s |\n", markdownEscape(c.Key.name(change.New)), f.Field, markdownEscape(f.Old), markdownEscape(f.New))
+			}
+		}
+	}
+
+	return res.Bytes()
+}
+
+func writeMarkdownEntries(w *bytes.Buffer, title string, comDetails []ComDetails) {
+	if len(comDetails) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	fmt.Fprintf(w, "\n### %s\n\n| %s |\n|%s\n", title, strings.Join(names, " | "), strings.Repeat(" --- |", len(fields)))
+	for _, cd := range comDetails {
+		values := fieldValues(cd)
+		for i := range values {
+			values[i] = markdownEscape(values[i])
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(values, " | "))
+	}
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,206 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Action is the operation a custom entry applies to the matrix.
+type Action string
+
+const (
+	// ActionAdd adds the entry to the matrix. It is the default action.
+	ActionAdd Action = "add"
+	// ActionRemove removes the entries matching the custom entry: entries with
+	// its protocol and with ports in its port or port range, and with its
+	// direction, node role, address family, node name, sources and
+	// destinations, each of which matches any value when empty. An entry of
+	// both address families is only matched by a custom entry of both. Of
+	// entries with only some of their ports in the custom entry ports, the
+	// other ports are kept.
+	ActionRemove Action = "remove"
+	// ActionOverride replaces the entries, or their ports, matching the custom
+	// entry, as ActionRemove does, with a single copy of it, or adds it if
+	// none match.
+	ActionOverride Action = "override"
+)
+
+// CustomEntry is a user-defined entry, adding, removing or overriding
+// entries of the matrix.
+type CustomEntry struct {
+	Action Action `json:"action,omitempty"`
+	ComDetails
+}
+
+// Override records an entry replaced by an override custom entry.
+type Override struct {
+	Old ComDetails
+	New ComDetails
+}
+
+// CustomEntriesReport records the entries removed or changed by custom entries.
+type CustomEntriesReport struct {
+	Removed    []ComDetails
+	Overridden []Override
+	// Unmatched are the remove and override custom entries which matched no entry.
+	Unmatched []CustomEntry
+}
+
+// Validate checks the entry as ComDetails.Validate does. Entries removing
+// entries only need a valid protocol and port, and a valid node role if set.
+func (ce CustomEntry) Validate() error {
+	switch ce.Action {
+	case "", ActionAdd, ActionOverride:
+		return ce.ComDetails.Validate()
+	case ActionRemove:
+		var errs []error
+		for _, err := range unwrapErrors(ce.ComDetails.Validate()) {
+			var fieldErr *FieldError
+			if errors.As(err, &fieldErr) && (fieldErr.Field == "direction" || (fieldErr.Field == "nodeRole" && ce.NodeRole == "")) {
+				continue
+			}
+			errs = append(errs, err)
+		}
+
+		return errors.Join(errs...)
+	default:
+		return &FieldError{Field: "action", Value: string(ce.Action), Reason: fmt.Sprintf("must be one of %s, %s, %s", ActionAdd, ActionRemove, ActionOverride)}
+	}
+}
+
+func (ce CustomEntry) matches(cd ComDetails) bool {
+	// The direction, node role, address family, node name, sources and
+	// destinations match any if not set.
+	target := ce.ComDetails
+	if target.NodeRole == "" {
+		target.NodeRole = cd.NodeRole
+	}
+	if target.AddressFamily == "" {
+		target.AddressFamily = cd.AddressFamily
+	}
+	if target.NodeName == "" {
+		target.NodeName = cd.NodeName
+	}
+	if target.Direction == "" {
+		target.Direction = cd.Direction
+	}
+	if target.SourceRole == "" {
+		target.SourceRole = cd.SourceRole
+	}
+	if target.SourceNetwork == "" {
+		target.SourceNetwork = cd.SourceNetwork
+	}
+	if target.SourceCIDR == "" {
+		target.SourceCIDR = cd.SourceCIDR
+	}
+	if target.DestinationRole == "" {
+		target.DestinationRole = cd.DestinationRole
+	}
+	if target.Destination == "" {
+		target.Destination = cd.Destination
+	}
+
+	return DefaultKey.covers(target, cd)
+}
+
+// split returns the part of the entry matched by the custom entry, the entry
+// with the ports of both, along with the entries of its other ports. ok is
+// false if the custom entry matches none of its ports.
+func (ce CustomEntry) split(cd ComDetails) (matched ComDetails, rest []ComDetails, ok bool) {
+	if !ce.Port.Overlaps(cd.Port) {
+		return ComDetails{}, nil, false
+	}
+
+	matched = cd
+	if ce.Port.Start > matched.Port.Start {
+		matched.Port.Start = ce.Port.Start
+	}
+	if ce.Port.End < matched.Port.End {
+		matched.Port.End = ce.Port.End
+	}
+	if !ce.matches(matched) {
+		return ComDetails{}, nil, false
+	}
+
+	return matched, withPorts(cd, cd.Port.Subtract(ce.Port)), true
+}
+
+func (ce CustomEntry) String() string {
+	action := ce.Action
+	if action == "" {
+		action = ActionAdd
+	}
+
+	return fmt.Sprintf("%s %s", action, ce.ComDetails)
+}
+
+// ApplyCustomEntries applies the custom entries, in order, to the base entries,
+// and returns the resulting entries along with a report of the removed and
+// overridden base entries.
+func ApplyCustomEntries(base []ComDetails, customEntries []CustomEntry) ([]ComDetails, CustomEntriesReport) {
+	res := append([]ComDetails{}, base...)
+	report := CustomEntriesReport{}
+
+	for _, ce := range customEntries {
+		switch ce.Action {
+		case "", ActionAdd:
+			res = append(res, ce.ComDetails)
+		case ActionRemove:
+			found := false
+			kept := make([]ComDetails, 0, len(res))
+			for _, cd := range res {
+				matched, rest, ok := ce.split(cd)
+				if !ok {
+					kept = append(kept, cd)
+					continue
+				}
+
+				report.Removed = append(report.Removed, matched)
+				kept = append(kept, rest...)
+				found = true
+			}
+
+			if !found {
+				report.Unmatched = append(report.Unmatched, ce)
+			}
+			res = kept
+		case ActionOverride:
+			found := false
+			kept := make([]ComDetails, 0, len(res))
+			for _, cd := range res {
+				matched, rest, ok := ce.split(cd)
+				if !ok {
+					kept = append(kept, cd)
+					continue
+				}
+
+				report.Overridden = append(report.Overridden, Override{Old: matched, New: ce.ComDetails})
+				kept = append(kept, rest...)
+				if !found {
+					kept = append(kept, ce.ComDetails)
+					found = true
+				}
+			}
+
+			if !found {
+				report.Unmatched = append(report.Unmatched, ce)
+				kept = append(kept, ce.ComDetails)
+			}
+			res = kept
+		}
+	}
+
+	return res, report
+}
+
+func unwrapErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+
+	return []error{err}
+}
@@ -0,0 +1,158 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyCustomEntries(t *testing.T) {
+	sshdMaster := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(22), NodeRole: "master", Service: "sshd"}
+	sshdWorker := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(22), NodeRole: "worker", Service: "sshd"}
+	rpcbindMaster := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(111), NodeRole: "master", Service: "rpcbind"}
+	rpcbindWorker := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(111), NodeRole: "worker", Service: "rpcbind"}
+	base := []ComDetails{sshdMaster, sshdWorker, rpcbindMaster, rpcbindWorker}
+
+	sshdOverride := sshdMaster
+	sshdOverride.Optional = true
+	added := ComDetails{Direction: "ingress", Protocol: "UDP", Port: SinglePort(4789), NodeRole: "worker", Service: "vxlan"}
+
+	customEntries := []CustomEntry{
+		{Action: ActionRemove, ComDetails: ComDetails{Protocol: "TCP", Port: SinglePort(111)}},
+		{Action: ActionRemove, ComDetails: ComDetails{Protocol: "TCP", Port: SinglePort(22), NodeRole: "worker"}},
+		{Action: ActionOverride, ComDetails: sshdOverride},
+		{Action: ActionRemove, ComDetails: ComDetails{Protocol: "UDP", Port: SinglePort(53)}},
+		{ComDetails: added},
+	}
+
+	res, report := ApplyCustomEntries(base, customEntries)
+
+	expected := []ComDetails{sshdOverride, added}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected %v got %v", expected, res)
+	}
+
+	expectedReport := CustomEntriesReport{
+		Removed:    []ComDetails{rpcbindMaster, rpcbindWorker, sshdWorker},
+		Overridden: []Override{{Old: sshdMaster, New: sshdOverride}},
+		Unmatched:  []CustomEntry{customEntries[3]},
+	}
+	if !reflect.DeepEqual(report, expectedReport) {
+		t.Fatalf("expected report %v got %v", expectedReport, report)
+	}
+}
+
+func TestParseCustomEntries(t *testing.T) {
+	raw := `- action: remove
+  protocol: TCP
+  port: "111"
+- action: disable
+  protocol: TCP
+  port: "22"
+`
+	_, err := ParseCustomEntries([]byte(raw), FormatYAML)
+	if err == nil || err.Error() != `entry 1 (line 4): field action: invalid value "disable": must be one of add, remove, override` {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	raw = "action,direction,protocol,port,nodeRole\nremove,,TCP,111,\n,ingress,UDP,4789,worker\n"
+	res, err := ParseCustomEntries([]byte(raw), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Action != ActionRemove || res[1].Port != SinglePort(4789) {
+		t.Fatalf("unexpected custom entries %v", res)
+	}
+}
+
+func TestApplyCustomEntriesNodesAndFamilies(t *testing.T) {
+	rpcbind := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(111), NodeRole: "worker", Service: "rpcbind"}
+	perNode := rpcbind
+	perNode.NodeName = "worker-1"
+	v4 := rpcbind
+	v4.AddressFamily = IPv4
+	v6 := rpcbind
+	v6.AddressFamily = IPv6
+	otherNode := perNode
+	otherNode.NodeName = "worker-2"
+
+	tests := []struct {
+		desc            string
+		customEntry     ComDetails
+		expectedRemoved []ComDetails
+	}{
+		{
+			desc:            "any-node-and-family",
+			customEntry:     ComDetails{Protocol: "TCP", Port: SinglePort(111), NodeRole: "worker"},
+			expectedRemoved: []ComDetails{rpcbind, perNode, v4, v6, otherNode},
+		},
+		{
+			desc:            "node",
+			customEntry:     ComDetails{Protocol: "TCP", Port: SinglePort(111), NodeRole: "worker", NodeName: "worker-1"},
+			expectedRemoved: []ComDetails{perNode},
+		},
+		{
+			desc:            "family",
+			customEntry:     ComDetails{Protocol: "TCP", Port: SinglePort(111), AddressFamily: IPv6},
+			expectedRemoved: []ComDetails{v6},
+		},
+	}
+	for _, test := range tests {
+		_, report := ApplyCustomEntries([]ComDetails{rpcbind, perNode, v4, v6, otherNode}, []CustomEntry{{Action: ActionRemove, ComDetails: test.customEntry}})
+		if !reflect.DeepEqual(report.Removed, test.expectedRemoved) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expectedRemoved, report.Removed)
+		}
+	}
+}
+
+func TestApplyCustomEntriesPortRanges(t *testing.T) {
+	nodePorts := ComDetails{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 30000, End: 32767}, NodeRole: "worker", Service: "kube-proxy"}
+	withRange := func(start, end int) ComDetails {
+		cd := nodePorts
+		cd.Port = PortRange{Start: start, End: end}
+		return cd
+	}
+	custom := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(30001), NodeRole: "worker", Service: "custom"}
+
+	tests := []struct {
+		desc        string
+		customEntry CustomEntry
+		expected    []ComDetails
+		matched     ComDetails
+	}{
+		{
+			desc:        "remove-port",
+			customEntry: CustomEntry{Action: ActionRemove, ComDetails: ComDetails{Protocol: "TCP", Port: SinglePort(30001)}},
+			expected:    []ComDetails{withRange(30000, 30000), withRange(30002, 32767)},
+			matched:     withRange(30001, 30001),
+		},
+		{
+			desc:        "remove-overlapping-range",
+			customEntry: CustomEntry{Action: ActionRemove, ComDetails: ComDetails{Protocol: "TCP", Port: PortRange{Start: 32000, End: 40000}}},
+			expected:    []ComDetails{withRange(30000, 31999)},
+			matched:     withRange(32000, 32767),
+		},
+		{
+			desc:        "override-port",
+			customEntry: CustomEntry{Action: ActionOverride, ComDetails: custom},
+			expected:    []ComDetails{withRange(30000, 30000), withRange(30002, 32767), custom},
+			matched:     withRange(30001, 30001),
+		},
+	}
+	for _, test := range tests {
+		res, report := ApplyCustomEntries([]ComDetails{nodePorts}, []CustomEntry{test.customEntry})
+		if !reflect.DeepEqual(res, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res)
+		}
+		if len(report.Unmatched) != 0 {
+			t.Fatalf("test %s failed. expected the custom entry to match got %v", test.desc, report.Unmatched)
+		}
+
+		matched := append([]ComDetails{}, report.Removed...)
+		for _, o := range report.Overridden {
+			matched = append(matched, o.Old)
+		}
+		if !reflect.DeepEqual(matched, []ComDetails{test.matched}) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.matched, matched)
+		}
+	}
+}
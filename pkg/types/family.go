@@ -0,0 +1,63 @@
+package types
+
+import (
+	"net"
+	"strings"
+)
+
+// AddressFamily is the IP family of an entry. Entries with no address family
+// apply to both IPv4 and IPv6.
+type AddressFamily string
+
+const (
+	IPv4 AddressFamily = "IPv4"
+	IPv6 AddressFamily = "IPv6"
+)
+
+// IsValid returns true if f is IPv4, IPv6 or unset.
+func (f AddressFamily) IsValid() bool {
+	return f == "" || f == IPv4 || f == IPv6
+}
+
+// Covers returns true if the entries of f apply to the entries of other,
+// i.e. if f is unset or the same family as other.
+func (f AddressFamily) Covers(other AddressFamily) bool {
+	return f == "" || f == other
+}
+
+// UnmarshalText parses the address family case insensitively, rejecting
+// unknown families.
+func (f *AddressFamily) UnmarshalText(text []byte) error {
+	for _, family := range []AddressFamily{"", IPv4, IPv6} {
+		if strings.EqualFold(strings.TrimSpace(string(text)), string(family)) {
+			*f = family
+			return nil
+		}
+	}
+
+	return &FieldError{Field: "addressFamily", Value: string(text), Reason: addressFamilyReason}
+}
+
+const addressFamilyReason = "must be IPv4, IPv6, or empty for both"
+
+// parseAddress returns the IP address or CIDR s in the nftables notation
+// along with its family, or false if s is neither.
+func parseAddress(s string) (string, AddressFamily, bool) {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String(), ipFamily(ip), true
+	}
+
+	if _, ipNet, err := net.ParseCIDR(s); err == nil {
+		return ipNet.String(), ipFamily(ipNet.IP), true
+	}
+
+	return "", "", false
+}
+
+func ipFamily(ip net.IP) AddressFamily {
+	if ip.To4() != nil {
+		return IPv4
+	}
+
+	return IPv6
+}
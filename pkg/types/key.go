@@ -0,0 +1,147 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Key lists the fields, by JSON name, identifying an entry when removing
+// duplicate entries, diffing and comparing matrices. An entry covers another
+// if their key fields are equal, except for the port, address family and
+// node name fields: the ports of the covered entry must be in the ports of
+// the covering one, and the covering entry applies to both address families
+// if its family is empty, and to every node of its role if its node name is
+// empty. The fields not in the key are the metadata of the entry.
+type Key []string
+
+// DefaultKey identifies entries by where they are open: their direction,
+// protocol, port, node role, address family, sources, destinations and node.
+var DefaultKey = Key{"direction", "protocol", "port", "nodeRole", "addressFamily",
+	"destinationRole", "destination", "sourceRole", "sourceNetwork", "sourceCIDR", "nodeName"}
+
+// ParseKey parses a comma separated list of fields. The port field is
+// required.
+func ParseKey(s string) (Key, error) {
+	res := Key{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || res.Has(name) {
+			continue
+		}
+		if !isField(name) {
+			return nil, fmt.Errorf("unknown key field %q, must be one of %s", name, fieldNames())
+		}
+		res = append(res, name)
+	}
+
+	if !res.Has("port") {
+		return nil, fmt.Errorf("key %q must include the port field", s)
+	}
+
+	return res, nil
+}
+
+func isField(name string) bool {
+	for _, f := range fields {
+		if f.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fieldNames() string {
+	names := []string{}
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Has returns true if the field is in the key.
+func (k Key) Has(field string) bool {
+	return contains(k, field)
+}
+
+func (k Key) String() string {
+	return strings.Join(k, ",")
+}
+
+// covers returns true if b covers a.
+func (k Key) covers(b, a ComDetails) bool {
+	for _, f := range fields {
+		if !k.Has(f.name) {
+			continue
+		}
+
+		var covered bool
+		switch f.name {
+		case "port":
+			covered = b.Port.Contains(a.Port)
+		case "addressFamily":
+			covered = b.AddressFamily.Covers(a.AddressFamily)
+		case "nodeName":
+			covered = b.NodeName == "" || b.NodeName == a.NodeName
+		default:
+			covered = f.value(b) == f.value(a)
+		}
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+// identity returns the values of the key fields of the entry.
+func (k Key) identity(cd ComDetails) string {
+	values := []string{}
+	for _, f := range fields {
+		if k.Has(f.name) {
+			values = append(values, f.value(cd))
+		}
+	}
+
+	return strings.Join(values, ",")
+}
+
+// name returns the set key fields of the entry, e.g.
+// "ingress TCP 6443 master machine".
+func (k Key) name(cd ComDetails) string {
+	values := []string{}
+	for _, f := range fields {
+		if v := f.value(cd); v != "" && k.Has(f.name) {
+			values = append(values, v)
+		}
+	}
+
+	return strings.Join(values, " ")
+}
+
+// RemoveDups removes the entries covered by another entry. Of entries
+// covering each other, the first is kept.
+func (k Key) RemoveDups(comDetails []ComDetails) []ComDetails {
+	res := []ComDetails{}
+	for i, item := range comDetails {
+		dup := false
+		for j, other := range comDetails {
+			if i == j || !k.covers(other, item) {
+				continue
+			}
+
+			// Of entries covering each other, i.e. with the same ports, keep the first.
+			if j < i || !k.covers(item, other) {
+				dup = true
+				break
+			}
+		}
+
+		if !dup {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,116 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+)
+
+// Network is a class of the networks of a cluster, which the traffic of an
+// entry comes from.
+type Network string
+
+const (
+	// NetworkMachine is the network of the nodes.
+	NetworkMachine Network = "machine"
+	// NetworkPod is the network of the pods.
+	NetworkPod Network = "pod"
+	// NetworkService is the network of the service cluster IPs.
+	NetworkService Network = "service"
+	// NetworkExternal is any network outside the cluster.
+	NetworkExternal Network = "external"
+)
+
+var validNetworks = []Network{NetworkMachine, NetworkPod, NetworkService, NetworkExternal}
+
+// IsValid returns true if n is a known network, or unset.
+func (n Network) IsValid() bool {
+	if n == "" {
+		return true
+	}
+
+	for _, valid := range validNetworks {
+		if n == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnmarshalText parses the network case insensitively, rejecting unknown
+// networks.
+func (n *Network) UnmarshalText(text []byte) error {
+	network := Network(strings.ToLower(strings.TrimSpace(string(text))))
+	if !network.IsValid() {
+		return &FieldError{Field: "sourceNetwork", Value: string(text), Reason: networkReason}
+	}
+	*n = network
+
+	return nil
+}
+
+const networkReason = "must be empty or one of machine, pod, service, external"
+
+// ClusterNetworks are the networks of a cluster, as CIDRs.
+type ClusterNetworks struct {
+	MachineNetworks []string
+	PodNetworks     []string
+	ServiceNetworks []string
+}
+
+// CIDRs returns the CIDRs of the network, or nil for external and unset
+// networks.
+func (n *ClusterNetworks) CIDRs(network Network) []string {
+	switch network {
+	case NetworkMachine:
+		return n.MachineNetworks
+	case NetworkPod:
+		return n.PodNetworks
+	case NetworkService:
+		return n.ServiceNetworks
+	default:
+		return nil
+	}
+}
+
+// RestrictSources returns the matrix with the ingress entries reached from the
+// cluster networks, or from a node role, restricted to the CIDRs of these
+// networks, i.e. with a copy of the entry per CIDR. Node roles are restricted
+// to the machine networks. Entries with a source CIDR, or reached from external
+// or unset networks, are kept as is.
+func (m *ComMatrix) RestrictSources() (*ComMatrix, error) {
+	if m.Networks == nil {
+		return nil, fmt.Errorf("the cluster networks of the matrix are unknown")
+	}
+
+	res := &ComMatrix{Networks: m.Networks, CustomEntriesReport: m.CustomEntriesReport}
+	for _, cd := range m.Matrix {
+		network := cd.SourceNetwork
+		if cd.SourceRole != "" {
+			network = NetworkMachine
+		}
+
+		cidrs := m.Networks.CIDRs(network)
+		if cd.Direction == consts.EgressLabel || cd.SourceCIDR != "" || len(cidrs) == 0 {
+			res.Matrix = append(res.Matrix, cd)
+			continue
+		}
+
+		for _, cidr := range cidrs {
+			restricted := cd
+			restricted.SourceCIDR = cidr
+			res.Matrix = append(res.Matrix, restricted)
+		}
+	}
+
+	return res, nil
+}
+
+// ToNftablesRestricted returns the nftables rules of the matrix as ToNftables
+// does, accepting the cluster internal ports only from the cluster networks.
+// See RestrictSources.
+func (m *ComMatrix) ToNftablesRestricted() ([]byte, error) {
+	return m.ToNftablesWithOptions(NftablesOptions{RestrictSources: true})
+}
@@ -0,0 +1,346 @@
+package types
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is a serialization format of a list of entries.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatCSV  Format = "csv"
+)
+
+// EntryError reports an invalid entry of a parsed list of entries.
+type EntryError struct {
+	// Index is the zero based index of the entry in the list.
+	Index int
+	// Line is the line the entry starts at, or 0 if unknown.
+	Line int
+	Err  error
+}
+
+func (e *EntryError) Error() string {
+	prefix := fmt.Sprintf("entry %d", e.Index)
+	if e.Line > 0 {
+		prefix = fmt.Sprintf("entry %d (line %d)", e.Index, e.Line)
+	}
+
+	// Report each of the joined field errors on its own line.
+	if joined, ok := e.Err.(interface{ Unwrap() []error }); ok {
+		lines := []string{}
+		for _, err := range joined.Unwrap() {
+			lines = append(lines, fmt.Sprintf("%s: %v", prefix, err))
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	return fmt.Sprintf("%s: %v", prefix, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// DetectFormat returns the format of the entries in raw, read from the file fp.
+// The format is detected by the file extension, or by the content if fp has
+// no known extension.
+func DetectFormat(fp string, raw []byte) Format {
+	switch strings.ToLower(filepath.Ext(fp)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".csv":
+		return FormatCSV
+	}
+
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		return FormatJSON
+	}
+
+	firstLine, _, _ := bytes.Cut(trimmed, []byte("\n"))
+	if bytes.Contains(firstLine, []byte(",")) && !bytes.Contains(firstLine, []byte(":")) {
+		return FormatCSV
+	}
+
+	return FormatYAML
+}
+
+type validator interface {
+	Validate() error
+}
+
+// ParseComDetails parses a list of entries in the given format, as written by
+// the ComMatrix ToJSON, ToYAML and ToCSV methods, and validates every entry.
+// Invalid entries are reported as *EntryError, wrapping the *FieldError of
+// each invalid field.
+func ParseComDetails(raw []byte, format Format) ([]ComDetails, error) {
+	return parseEntries[ComDetails](raw, format)
+}
+
+// ParseCustomEntries parses and validates a list of custom entries in the given
+// format, as ParseComDetails does.
+func ParseCustomEntries(raw []byte, format Format) ([]CustomEntry, error) {
+	return parseEntries[CustomEntry](raw, format)
+}
+
+func parseEntries[T validator](raw []byte, format Format) ([]T, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON[T](raw)
+	case FormatYAML:
+		return parseYAML[T](raw)
+	case FormatCSV:
+		return parseCSV[T](raw)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func parseJSON[T validator](raw []byte) ([]T, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entries: %w", err)
+	}
+	// ComMatrix.ToJSON writes a matrix without entries as null.
+	if tok == nil {
+		return []T{}, endOfJSON(dec, raw)
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("failed to unmarshal entries: expected an array of entries, got %v", tok)
+	}
+
+	res := []T{}
+	lines := []int{}
+	for i := 0; dec.More(); i++ {
+		line := lineAt(raw, int(dec.InputOffset()))
+
+		var cd T
+		if err := dec.Decode(&cd); err != nil {
+			return nil, &EntryError{Index: i, Line: line, Err: err}
+		}
+
+		res = append(res, cd)
+		lines = append(lines, line)
+	}
+
+	// Consume the closing bracket.
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entries: %w", err)
+	}
+	if err := endOfJSON(dec, raw); err != nil {
+		return nil, err
+	}
+
+	if err := validateEntries(res, lines); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func parseYAML[T validator](raw []byte) ([]T, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal entries: %w", err)
+	}
+
+	// Support the output of ToYAML, which nests the entries under the Matrix key.
+	list := &doc
+	if len(list.Content) > 0 {
+		list = list.Content[0]
+	}
+	if list.Kind == yamlv3.MappingNode && len(list.Content) == 2 && list.Content[0].Value == "Matrix" {
+		list = list.Content[1]
+	}
+	if list.Kind == yamlv3.ScalarNode && list.Tag == "!!null" {
+		return []T{}, nil
+	}
+	if list.Kind != yamlv3.SequenceNode {
+		return nil, fmt.Errorf("failed to unmarshal entries: expected a list of entries (line %d)", list.Line)
+	}
+
+	res := []T{}
+	lines := []int{}
+	for i, item := range list.Content {
+		out, err := yamlv3.Marshal(item)
+		if err != nil {
+			return nil, &EntryError{Index: i, Line: item.Line, Err: err}
+		}
+
+		// Decode through JSON rather than with yaml.UnmarshalStrict, which
+		// flattens the *FieldError of invalid ports and protocols to strings.
+		j, err := yaml.YAMLToJSON(out)
+		if err != nil {
+			return nil, &EntryError{Index: i, Line: item.Line, Err: err}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(j))
+		dec.DisallowUnknownFields()
+
+		var cd T
+		if err := dec.Decode(&cd); err != nil {
+			return nil, &EntryError{Index: i, Line: item.Line, Err: err}
+		}
+
+		res = append(res, cd)
+		lines = append(lines, item.Line)
+	}
+
+	if err := validateEntries(res, lines); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func parseCSV[T validator](raw []byte) ([]T, error) {
+	r := csv.NewReader(bytes.NewReader(raw))
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return []T{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CSV header: %w", err)
+	}
+
+	fields := csvFields(reflect.TypeOf(*new(T)))
+	for _, name := range header {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+	}
+
+	res := []T{}
+	lines := []int{}
+	for i := 0; ; i++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+
+		var cd T
+		v := reflect.ValueOf(&cd).Elem()
+		for col, value := range record {
+			if err := setField(v.FieldByIndex(fields[header[col]]), value); err != nil {
+				var fieldErr *FieldError
+				if !errors.As(err, &fieldErr) {
+					fieldErr = &FieldError{Field: header[col], Value: value, Reason: err.Error()}
+				}
+				return nil, &EntryError{Index: i, Line: line, Err: fieldErr}
+			}
+		}
+
+		res = append(res, cd)
+		lines = append(lines, line)
+	}
+
+	if err := validateEntries(res, lines); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// csvFields maps the JSON names of the fields of t, including the ones of
+// embedded structs, to their index.
+func csvFields(t reflect.Type) map[string][]int {
+	res := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for name, index := range csvFields(f.Type) {
+				res[name] = append([]int{i}, index...)
+			}
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		res[name] = []int{i}
+	}
+
+	return res
+}
+
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(false)
+			return nil
+		}
+
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported CSV field kind %s", field.Kind())
+	}
+
+	return nil
+}
+
+func validateEntries[T validator](comDetails []T, lines []int) error {
+	var errs []error
+	for i, cd := range comDetails {
+		if err := cd.Validate(); err != nil {
+			errs = append(errs, &EntryError{Index: i, Line: lines[i], Err: err})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// lineAt returns the line of the first entry character at or after offset,
+// skipping whitespace and separators.
+// endOfJSON returns an error if there is content after the decoded entries.
+func endOfJSON(dec *json.Decoder, raw []byte) error {
+	line := lineAt(raw, int(dec.InputOffset()))
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("failed to unmarshal entries: unexpected content after the entries at line %d", line)
+	}
+
+	return nil
+}
+
+func lineAt(raw []byte, offset int) int {
+	for offset < len(raw) && strings.ContainsRune(" \t\r\n,", rune(raw[offset])) {
+		offset++
+	}
+
+	return bytes.Count(raw[:offset], []byte("\n")) + 1
+}
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseComDetails(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: SinglePort(22), Namespace: "system", Service: "sshd", NodeRole: "master", Optional: true},
+		{Direction: "ingress", Protocol: "UDP", Port: SinglePort(4789), NodeRole: "worker", SourceRole: "master", SourceNetwork: NetworkMachine},
+		{Direction: "egress", Protocol: "TCP", Port: SinglePort(6443), NodeRole: "worker", Service: "kube-apiserver", DestinationRole: "master"},
+		{Direction: "egress", Protocol: "UDP", Port: SinglePort(123), NodeRole: "master", Service: `chronyd, "ntp"`, Destination: "10.0.0.1"},
+	}}
+	tests := []struct {
+		format  Format
+		marshal func() ([]byte, error)
+	}{
+		{format: FormatJSON, marshal: m.ToJSON},
+		{format: FormatYAML, marshal: m.ToYAML},
+		{format: FormatCSV, marshal: m.ToCSV},
+	}
+	for _, test := range tests {
+		raw, err := test.marshal()
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.format, err)
+		}
+
+		if format := DetectFormat("", raw); format != test.format {
+			t.Fatalf("test %s failed. detected format %s", test.format, format)
+		}
+
+		res, err := ParseComDetails(raw, test.format)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.format, err)
+		}
+		if !reflect.DeepEqual(res, m.Matrix) {
+			t.Fatalf("test %s failed. expected %v got %v", test.format, m.Matrix, res)
+		}
+	}
+}
+
+func TestParseComDetailsErrors(t *testing.T) {
+	tests := []struct {
+		desc   string
+		format Format
+		raw    string
+		index  int
+		line   int
+		field  string
+	}{
+		{
+			desc:   "json-invalid-protocol",
+			format: FormatJSON,
+			raw: `[
+  {"direction": "ingress", "protocol": "TCP", "port": "22", "nodeRole": "master"},
+  {"direction": "ingress", "protocol": "ICMP", "port": "22", "nodeRole": "master"}
+]`,
+			index: 1,
+			line:  3,
+			field: "protocol",
+		},
+		{
+			desc:   "yaml-port-out-of-range",
+			format: FormatYAML,
+			raw: `- direction: ingress
+  protocol: TCP
+  port: "65536"
+  nodeRole: worker
+`,
+			index: 0,
+			line:  1,
+			field: "port",
+		},
+		{
+			desc:   "csv-unknown-role",
+			format: FormatCSV,
+			raw:    "direction,protocol,port,nodeRole\ningress,TCP,22,master\ningress,TCP,22,\n",
+			index:  1,
+			line:   3,
+			field:  "nodeRole",
+		},
+	}
+	for _, test := range tests {
+		_, err := ParseComDetails([]byte(test.raw), test.format)
+
+		var entryErr *EntryError
+		if !errors.As(err, &entryErr) {
+			t.Fatalf("test %s failed. expected an EntryError got %v", test.desc, err)
+		}
+		if entryErr.Index != test.index || entryErr.Line != test.line {
+			t.Fatalf("test %s failed. expected entry %d line %d got %v", test.desc, test.index, test.line, entryErr)
+		}
+
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != test.field {
+			t.Fatalf("test %s failed. expected an error of field %s got %v", test.desc, test.field, err)
+		}
+	}
+}
+
+func TestParseComDetailsMalformedJSON(t *testing.T) {
+	tests := []struct {
+		desc string
+		raw  string
+	}{
+		{desc: "object", raw: `{}`},
+		{desc: "unterminated", raw: `[{"direction": "ingress", "protocol": "TCP", "port": "22", "nodeRole": "master"}`},
+		{
+			desc: "trailing-array",
+			raw: `[{"direction": "ingress", "protocol": "TCP", "port": "22", "nodeRole": "master"}]
+[{"direction": "ingress", "protocol": "ICMP", "port": "22", "nodeRole": "master"}]`,
+		},
+		{desc: "trailing-content", raw: `[] x`},
+		{desc: "trailing-null", raw: `null null`},
+	}
+	for _, test := range tests {
+		if res, err := ParseComDetails([]byte(test.raw), FormatJSON); err == nil {
+			t.Fatalf("test %s failed. expected an error got %v", test.desc, res)
+		}
+		if res, err := ParseCustomEntries([]byte(test.raw), FormatJSON); err == nil {
+			t.Fatalf("test %s failed. expected an error got %v", test.desc, res)
+		}
+	}
+
+	// A matrix without entries is written as null.
+	if res, err := ParseComDetails([]byte("null\n"), FormatJSON); err != nil || len(res) != 0 {
+		t.Fatalf("test null failed. expected no entries got %v, %v", res, err)
+	}
+}
+
+func TestParseComDetailsNormalization(t *testing.T) {
+	expected := []ComDetails{
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(22), NodeRole: "master"},
+		{Direction: "ingress", Protocol: ProtocolSCTP, Port: PortRange{Start: 30000, End: 32767}, NodeRole: "worker"},
+	}
+	tests := []struct {
+		format Format
+		raw    string
+	}{
+		{
+			format: FormatJSON,
+			raw: `[{"direction": "ingress", "protocol": "tcp", "port": 22, "nodeRole": "master"},
+{"direction": "ingress", "protocol": "Sctp", "port": "30000-32767", "nodeRole": "worker"}]`,
+		},
+		{
+			format: FormatYAML,
+			raw: `- {direction: ingress, protocol: tcp, port: 22, nodeRole: master}
+- {direction: ingress, protocol: Sctp, port: 30000-32767, nodeRole: worker}
+`,
+		},
+		{
+			format: FormatCSV,
+			raw:    "direction,protocol,port,nodeRole\ningress,tcp,22,master\ningress,Sctp,30000-32767,worker\n",
+		},
+	}
+	for _, test := range tests {
+		res, err := ParseComDetails([]byte(test.raw), test.format)
+		if err != nil {
+			t.Fatalf("test %s failed: %v", test.format, err)
+		}
+		if !reflect.DeepEqual(res, expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.format, expected, res)
+		}
+	}
+}
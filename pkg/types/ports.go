@@ -0,0 +1,178 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	minPort = 1
+	maxPort = 65535
+
+	portReason = "must be a port or a range of ports between 1 and 65535, e.g. 22 or 30000-32767"
+)
+
+// PortRange is an inclusive range of port numbers, written as "30000-32767".
+// A single port has equal Start and End, and is written as "22".
+type PortRange struct {
+	Start int
+	End   int
+}
+
+// SinglePort returns the range of the given port only.
+func SinglePort(port int) PortRange {
+	return PortRange{Start: port, End: port}
+}
+
+// ParsePortRange parses a port number or a range of port numbers.
+func ParsePortRange(s string) (PortRange, error) {
+	start, end, isRange := strings.Cut(s, "-")
+	if !isRange {
+		end = start
+	}
+
+	startPort, err := parsePort(start)
+	if err != nil {
+		return PortRange{}, err
+	}
+
+	endPort, err := parsePort(end)
+	if err != nil {
+		return PortRange{}, err
+	}
+
+	if startPort > endPort {
+		return PortRange{}, fmt.Errorf("range start %d is greater than its end %d", startPort, endPort)
+	}
+
+	return PortRange{Start: startPort, End: endPort}, nil
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port < minPort || port > maxPort {
+		return 0, fmt.Errorf("%q is not a number between %d and %d", s, minPort, maxPort)
+	}
+
+	return port, nil
+}
+
+// IsValid returns true if r is a non-empty range of ports between 1 and 65535.
+func (r PortRange) IsValid() bool {
+	return minPort <= r.Start && r.Start <= r.End && r.End <= maxPort
+}
+
+// MarshalText writes the range as a string, e.g. "22" or "30000-32767".
+func (r PortRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses a port or a range of ports, rejecting ports out of
+// range. An empty string leaves the range unset.
+func (r *PortRange) UnmarshalText(text []byte) error {
+	if len(bytes.TrimSpace(text)) == 0 {
+		*r = PortRange{}
+		return nil
+	}
+
+	res, err := ParsePortRange(string(text))
+	if err != nil {
+		return &FieldError{Field: "port", Value: string(text), Reason: portReason}
+	}
+	*r = res
+
+	return nil
+}
+
+// UnmarshalJSON accepts a port number as well as a string.
+func (r *PortRange) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(`"`)) {
+		var port json.Number
+		if err := json.Unmarshal(data, &port); err != nil {
+			return &FieldError{Field: "port", Value: string(data), Reason: portReason}
+		}
+
+		return r.UnmarshalText([]byte(port))
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return r.UnmarshalText([]byte(s))
+}
+
+func (r PortRange) String() string {
+	if r.Start == r.End {
+		return strconv.Itoa(r.Start)
+	}
+
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// Contains returns true if every port of other is in r.
+func (r PortRange) Contains(other PortRange) bool {
+	return r.Start <= other.Start && other.End <= r.End
+}
+
+// Overlaps returns true if r and other have ports in common.
+func (r PortRange) Overlaps(other PortRange) bool {
+	return r.Start <= other.End && other.Start <= r.End
+}
+
+// Subtract returns the ports of r which are not in other, as up to two ranges.
+func (r PortRange) Subtract(other PortRange) []PortRange {
+	if !r.Overlaps(other) {
+		return []PortRange{r}
+	}
+
+	res := []PortRange{}
+	if r.Start < other.Start {
+		res = append(res, PortRange{Start: r.Start, End: other.Start - 1})
+	}
+	if other.End < r.End {
+		res = append(res, PortRange{Start: other.End + 1, End: r.End})
+	}
+
+	return res
+}
+
+// subtractPortRanges returns the ports of ranges which are not in other.
+func subtractPortRanges(ranges, other []PortRange) []PortRange {
+	res := append([]PortRange{}, ranges...)
+	for _, o := range other {
+		next := []PortRange{}
+		for _, r := range res {
+			next = append(next, r.Subtract(o)...)
+		}
+		res = next
+	}
+
+	return res
+}
+
+// MergePortRanges returns the ranges sorted, with overlapping and adjacent
+// ranges merged.
+func MergePortRanges(ranges []PortRange) []PortRange {
+	sorted := append([]PortRange{}, ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	res := []PortRange{}
+	for _, r := range sorted {
+		last := len(res) - 1
+		if last >= 0 && r.Start <= res[last].End+1 {
+			if r.End > res[last].End {
+				res[last].End = r.End
+			}
+			continue
+		}
+		res = append(res, r)
+	}
+
+	return res
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		port      string
+		expected  PortRange
+		expectErr bool
+	}{
+		{port: "22", expected: PortRange{Start: 22, End: 22}},
+		{port: "30000-32767", expected: PortRange{Start: 30000, End: 32767}},
+		{port: "0", expectErr: true},
+		{port: "65536", expectErr: true},
+		{port: "9000-8000", expectErr: true},
+		{port: "http", expectErr: true},
+	}
+	for _, test := range tests {
+		res, err := ParsePortRange(test.port)
+		if test.expectErr != (err != nil) {
+			t.Fatalf("test %s failed. expected error %v got %v", test.port, test.expectErr, err)
+		}
+		if res != test.expected {
+			t.Fatalf("test %s failed. expected %v got %v", test.port, test.expected, res)
+		}
+	}
+}
+
+func TestMergePortRanges(t *testing.T) {
+	ranges := []PortRange{{Start: 9000, End: 9999}, {Start: 22, End: 22}, {Start: 9100, End: 10100}, {Start: 10101, End: 10101}, {Start: 443, End: 443}}
+	expected := []PortRange{{Start: 22, End: 22}, {Start: 443, End: 443}, {Start: 9000, End: 10101}}
+
+	res := MergePortRanges(ranges)
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected %v got %v", expected, res)
+	}
+}
+
+func TestRemoveDupsPortRanges(t *testing.T) {
+	nodePorts := ComDetails{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 30000, End: 32767}, NodeRole: "worker"}
+	nodePort := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(30080), NodeRole: "worker"}
+	masterNodePort := ComDetails{Direction: "ingress", Protocol: "TCP", Port: SinglePort(30080), NodeRole: "master"}
+	overlapping := ComDetails{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 32000, End: 33000}, NodeRole: "worker"}
+
+	res := RemoveDups([]ComDetails{nodePort, nodePorts, masterNodePort, overlapping, nodePorts})
+	expected := []ComDetails{nodePorts, masterNodePort, overlapping}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("expected %v got %v", expected, res)
+	}
+}
+
+func TestDiffPortRanges(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 9000, End: 9999}, NodeRole: "master"},
+		{Direction: "ingress", Protocol: "TCP", Port: SinglePort(22), NodeRole: "master"},
+	}}
+	other := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 9100, End: 9199}, NodeRole: "master"},
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 9500, End: 10000}, NodeRole: "master"},
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 1, End: 100}, NodeRole: "master"},
+	}}
+	expected := []ComDetails{
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 9000, End: 9099}, NodeRole: "master"},
+		{Direction: "ingress", Protocol: "TCP", Port: PortRange{Start: 9200, End: 9499}, NodeRole: "master"},
+	}
+
+	res := m.Diff(other)
+	if !reflect.DeepEqual(res.Matrix, expected) {
+		t.Fatalf("expected %v got %v", expected, res.Matrix)
+	}
+}
@@ -0,0 +1,62 @@
+package types
+
+import "strings"
+
+// Protocol is the transport protocol of an entry. It is unmarshaled case
+// insensitively, and unknown protocols are rejected.
+type Protocol string
+
+const (
+	ProtocolTCP  Protocol = "TCP"
+	ProtocolUDP  Protocol = "UDP"
+	ProtocolSCTP Protocol = "SCTP"
+)
+
+var validProtocols = []Protocol{ProtocolTCP, ProtocolUDP, ProtocolSCTP}
+
+// ParseProtocol returns the protocol matching s, case insensitive.
+func ParseProtocol(s string) (Protocol, error) {
+	p := Protocol(strings.ToUpper(strings.TrimSpace(s)))
+	if !p.IsValid() {
+		return "", &FieldError{Field: "protocol", Value: s, Reason: "must be one of " + joinProtocols(validProtocols)}
+	}
+
+	return p, nil
+}
+
+// IsValid returns true if p is a known protocol.
+func (p Protocol) IsValid() bool {
+	for _, valid := range validProtocols {
+		if p == valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnmarshalText parses the protocol case insensitively, rejecting unknown
+// protocols. An empty protocol is left unset.
+func (p *Protocol) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = ""
+		return nil
+	}
+
+	res, err := ParseProtocol(string(text))
+	if err != nil {
+		return err
+	}
+	*p = res
+
+	return nil
+}
+
+func joinProtocols(protocols []Protocol) string {
+	res := make([]string, 0, len(protocols))
+	for _, p := range protocols {
+		res = append(res, string(p))
+	}
+
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,107 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictPolicy selects how Merge resolves the entries of both matrices with
+// the same key fields but different other fields.
+type ConflictPolicy string
+
+const (
+	// PreferLeft keeps the entries of the matrix merged into.
+	PreferLeft ConflictPolicy = "prefer-left"
+	// PreferRight keeps the entries of the merged matrix.
+	PreferRight ConflictPolicy = "prefer-right"
+	// FailOnConflict fails the merge with a *MergeConflictError.
+	FailOnConflict ConflictPolicy = "error"
+)
+
+var validConflictPolicies = []ConflictPolicy{PreferLeft, PreferRight, FailOnConflict}
+
+// ParseConflictPolicy parses a conflict policy, one of prefer-left,
+// prefer-right or error.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, p := range validConflictPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown conflict policy %q, must be one of %s, %s, %s", s, PreferLeft, PreferRight, FailOnConflict)
+}
+
+// MergeConflictError reports the conflicting entries of a merge.
+type MergeConflictError struct {
+	Conflicts []Change
+}
+
+func (e *MergeConflictError) Error() string {
+	conflicts := []string{}
+	for _, c := range e.Conflicts {
+		conflicts = append(conflicts, fmt.Sprintf("%s (%s)", c.Old, c.delta()))
+	}
+
+	return fmt.Sprintf("%d conflicting entries: %s", len(e.Conflicts), strings.Join(conflicts, ", "))
+}
+
+// Union returns the entries of m and other, without the entries covered by
+// another entry with the given key.
+func (m ComMatrix) Union(other ComMatrix, key Key) ComMatrix {
+	all := append(append([]ComDetails{}, m.Matrix...), other.Matrix...)
+
+	return ComMatrix{Matrix: key.RemoveDups(all), Networks: m.Networks}
+}
+
+// Intersect returns the entries of m, or their ports, which are in other
+// with the given key.
+func (m ComMatrix) Intersect(other ComMatrix, key Key) ComMatrix {
+	res := m.DiffByKey(m.DiffByKey(other, key), key)
+	res.Networks = m.Networks
+
+	return res
+}
+
+// Subtract returns the entries of m, or their ports, which are not in other
+// with the given key. It is DiffByKey.
+func (m ComMatrix) Subtract(other ComMatrix, key Key) ComMatrix {
+	res := m.DiffByKey(other, key)
+	res.Networks = m.Networks
+
+	return res
+}
+
+// Merge returns the union of m and other, where the entries of both with
+// the same key fields but different other fields, as reported by
+// CompareByKey, are resolved by the conflict policy.
+func (m ComMatrix) Merge(other ComMatrix, key Key, policy ConflictPolicy) (ComMatrix, error) {
+	if _, err := ParseConflictPolicy(string(policy)); err != nil {
+		return ComMatrix{}, err
+	}
+
+	comparison := m.CompareByKey(other, key)
+	if policy == FailOnConflict && len(comparison.Changed) > 0 {
+		return ComMatrix{}, &MergeConflictError{Conflicts: comparison.Changed}
+	}
+
+	replacements := map[ComDetails]ComDetails{}
+	if policy == PreferRight {
+		for _, change := range comparison.Changed {
+			replacements[change.Old] = change.New
+		}
+	}
+
+	res := []ComDetails{}
+	for _, cd := range m.Matrix {
+		if replacement, ok := replacements[cd]; ok {
+			cd = replacement
+		}
+		res = append(res, cd)
+	}
+	// Of entries covering each other, RemoveDups keeps the first, i.e. the
+	// entries of m, possibly replaced by their conflicting entries of other.
+	res = append(res, other.Matrix...)
+
+	return ComMatrix{Matrix: key.RemoveDups(res), Networks: m.Networks}, nil
+}
@@ -4,47 +4,80 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
 
-	"github.com/liornoy/node-comm-lib/pkg/nftables"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/yaml"
+
+	"github.com/liornoy/node-comm-lib/pkg/consts"
+	"github.com/liornoy/node-comm-lib/pkg/nftables"
 )
 
 type ComMatrix struct {
 	Matrix []ComDetails
+	// CustomEntriesReport records the entries removed or overridden by custom
+	// entries when the matrix was generated.
+	CustomEntriesReport *CustomEntriesReport `json:"-"`
+	// Networks are the networks of the cluster the matrix was generated
+	// from, or nil if unknown.
+	Networks *ClusterNetworks `json:"-"`
 }
 
 type ComDetails struct {
-	Direction string `json:"direction"`
-	Protocol  string `json:"protocol"`
-	Port      string `json:"port"`
-	Namespace string `json:"namespace"`
-	Service   string `json:"service"`
-	Pod       string `json:"pod"`
-	Container string `json:"container"`
-	NodeRole  string `json:"nodeRole"`
-	Optional  bool   `json:"optional"`
+	Direction string    `json:"direction"`
+	Protocol  Protocol  `json:"protocol"`
+	Port      PortRange `json:"port"`
+	Namespace string    `json:"namespace"`
+	Service   string    `json:"service"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	NodeRole  string    `json:"nodeRole"`
+	Optional  bool      `json:"optional"`
+	// AddressFamily is the IP family the port is open on, or empty if it is
+	// open on both.
+	AddressFamily AddressFamily `json:"addressFamily,omitempty"`
+	// DestinationRole is the node role egress entries connect to, for
+	// connections between the nodes, e.g. to the API server or etcd peers.
+	DestinationRole string `json:"destinationRole,omitempty"`
+	// Destination is the host, IP address or CIDR egress entries connect to
+	// outside the cluster, e.g. an NTP server or the cloud metadata endpoint.
+	Destination string `json:"destination,omitempty"`
+	// SourceRole is the node role ingress entries are reached from, for
+	// connections between the nodes.
+	SourceRole string `json:"sourceRole,omitempty"`
+	// SourceNetwork is the network ingress entries are reached from.
+	SourceNetwork Network `json:"sourceNetwork,omitempty"`
+	// SourceCIDR is the IP address or CIDR ingress entries are reached from.
+	SourceCIDR string `json:"sourceCIDR,omitempty"`
+	// NodeName is the node the port is open on, or empty if it is open on
+	// every node of the node role.
+	NodeName string `json:"nodeName,omitempty"`
 }
 
+// ToCSV returns the entries with a column per field, quoting the values
+// with commas, quotes or newlines.
 func (m *ComMatrix) ToCSV() ([]byte, error) {
-	var header = "direction,protocol,port,namespace,service,pod,container,nodeRole,optional"
-
-	out := make([]byte, 0)
-	w := bytes.NewBuffer(out)
+	w := &bytes.Buffer{}
 	csvwriter := csv.NewWriter(w)
 
-	csvwriter.Write(strings.Split(header, ","))
+	header := []string{}
+	for _, f := range fields {
+		header = append(header, f.name)
+	}
 
+	records := [][]string{header}
 	for _, cd := range m.Matrix {
-		record := strings.Split(cd.String(), ",")
-		err := csvwriter.Write(record)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert to CSV foramt: %w", err)
-		}
+		records = append(records, fieldValues(cd))
+	}
+
+	err := csvwriter.WriteAll(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to CSV format: %w", err)
 	}
-	csvwriter.Flush()
 
 	return w.Bytes(), nil
 }
@@ -67,20 +100,75 @@ func (m *ComMatrix) ToYAML() ([]byte, error) {
 	return out, nil
 }
 
+// NftablesOptions configures the nftables ruleset of a matrix.
+type NftablesOptions struct {
+	// RestrictSources accepts the cluster internal ports only from the
+	// cluster networks, see RestrictSources.
+	RestrictSources bool
+	// DropEgress drops the egress traffic not accepted by the egress entries.
+	// By default the output chain accepts it, as the static egress entries
+	// don't cover all the traffic of the nodes, e.g. to the overlay network,
+	// webhooks, cloud provider APIs, mirror registries and proxies.
+	DropEgress bool
+}
+
+// ToNftables returns the nftables ruleset of the matrix with the default
+// options.
 func (m *ComMatrix) ToNftables() ([]byte, error) {
-	var res bytes.Buffer
-	data := nftables.Data{
-		AllowedTCPPorts: make([]string, 0),
-		AllowedUDPPorts: make([]string, 0),
+	return m.ToNftablesWithOptions(NftablesOptions{})
+}
+
+// ToNftablesWithOptions returns the nftables ruleset of the matrix configured
+// by opts.
+func (m *ComMatrix) ToNftablesWithOptions(opts NftablesOptions) ([]byte, error) {
+	if opts.RestrictSources {
+		restricted, err := m.RestrictSources()
+		if err != nil {
+			return nil, err
+		}
+		m = restricted
 	}
 
+	var res bytes.Buffer
+	data := nftables.Data{Rules: make([]nftables.Rule, 0), EgressRules: make([]nftables.Rule, 0), DropEgress: opts.DropEgress}
+
+	ingress := map[string][]ComDetails{}
+	egress := map[string][]ComDetails{}
 	for _, cd := range m.Matrix {
-		if cd.Protocol == "TCP" {
-			data.AllowedTCPPorts = append(data.AllowedTCPPorts, cd.Port)
+		if !cd.Protocol.IsValid() || !cd.Port.IsValid() || !cd.AddressFamily.IsValid() {
+			return nil, fmt.Errorf("invalid entry %s: %w", cd, cd.Validate())
+		}
+
+		// Group the entries by source address, or destination address for
+		// egress entries. Destinations which are not IP addresses or CIDRs,
+		// i.e. host names, are grouped by name.
+		groups, addr := ingress, cd.SourceCIDR
+		if cd.Direction == consts.EgressLabel {
+			groups, addr = egress, cd.Destination
 		}
-		if cd.Protocol == "UDP" {
-			data.AllowedUDPPorts = append(data.AllowedUDPPorts, cd.Port)
+
+		parsed, family, ok := parseAddress(addr)
+		if ok {
+			cd.AddressFamily = family
+			addr = parsed
 		}
+		groups[addr] = append(groups[addr], cd)
+	}
+
+	for _, saddr := range sortedKeys(ingress) {
+		data.Rules = append(data.Rules, nftablesRules(ingress[saddr], saddr, "")...)
+	}
+	for _, daddr := range sortedKeys(egress) {
+		rules := nftablesRules(egress[daddr], "", daddr)
+		if _, _, ok := parseAddress(daddr); !ok && daddr != "" {
+			// nftables only matches addresses, so the rules of host names
+			// are allowed to any address.
+			rules = nftablesRules(egress[daddr], "", "")
+			for i := range rules {
+				rules[i].Comment = fmt.Sprintf("to %s, allowed to any address as it is not an IP address", daddr)
+			}
+		}
+		data.EgressRules = append(data.EgressRules, rules...)
 	}
 
 	tmpl, err := template.New("nftablesTemplate").Parse(nftables.Template)
@@ -96,6 +184,75 @@ func (m *ComMatrix) ToNftables() ([]byte, error) {
 	return res.Bytes(), nil
 }
 
+func sortedKeys(m map[string][]ComDetails) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// nftablesRules returns the rules accepting the ports of the entries, per
+// protocol and address family, restricted to the source address saddr and
+// the destination address daddr if set.
+func nftablesRules(comDetails []ComDetails, saddr, daddr string) []nftables.Rule {
+	rules := []nftables.Rule{}
+	for _, protocol := range validProtocols {
+		ranges := portRanges(comDetails, protocol)
+		for _, family := range []AddressFamily{"", IPv4, IPv6} {
+			if len(ranges[family]) == 0 {
+				continue
+			}
+
+			rule := nftables.Rule{Family: strings.ToLower(string(family)), Protocol: strings.ToLower(string(protocol)), Saddr: saddr, Daddr: daddr}
+			for _, r := range ranges[family] {
+				rule.Ports = append(rule.Ports, r.String())
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// portRanges returns the merged port ranges of the entries with the given
+// protocol, as nftables rejects sets with overlapping ranges, by the address
+// family they are open on. Ports open on IPv4 and on IPv6 by separate entries
+// are returned as open on both.
+func portRanges(comDetails []ComDetails, protocol Protocol) map[AddressFamily][]PortRange {
+	ranges := map[AddressFamily][]PortRange{}
+	for _, cd := range comDetails {
+		if cd.Protocol == protocol {
+			ranges[cd.AddressFamily] = append(ranges[cd.AddressFamily], cd.Port)
+		}
+	}
+
+	v4 := subtractPortRanges(ranges[IPv4], ranges[""])
+	v6 := subtractPortRanges(ranges[IPv6], ranges[""])
+	both := subtractPortRanges(v4, subtractPortRanges(v4, v6))
+
+	return map[AddressFamily][]PortRange{
+		"":   MergePortRanges(append(ranges[""], both...)),
+		IPv4: MergePortRanges(subtractPortRanges(v4, both)),
+		IPv6: MergePortRanges(subtractPortRanges(v6, both)),
+	}
+}
+
+// ForNode returns the entries of m open on the given node: the entries of the
+// node and the entries of its roles which are not specific to a node.
+func (m *ComMatrix) ForNode(name string, roles []string) *ComMatrix {
+	res := &ComMatrix{Matrix: []ComDetails{}, Networks: m.Networks}
+	for _, cd := range m.Matrix {
+		if cd.NodeName == name || (cd.NodeName == "" && contains(roles, cd.NodeRole)) {
+			res.Matrix = append(res.Matrix, cd)
+		}
+	}
+
+	return res
+}
+
 func (m *ComMatrix) String() string {
 	var result strings.Builder
 	for _, details := range m.Matrix {
@@ -106,40 +263,173 @@ func (m *ComMatrix) String() string {
 }
 
 func (cd ComDetails) String() string {
-	return fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%v", cd.Direction, cd.Protocol, cd.Port, cd.Namespace, cd.Service, cd.Pod, cd.Container, cd.NodeRole, cd.Optional)
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%v,%s,%s,%s,%s,%s,%s,%s", cd.Direction, cd.Protocol, cd.Port, cd.Namespace, cd.Service, cd.Pod, cd.Container, cd.NodeRole, cd.Optional,
+		cd.AddressFamily, cd.DestinationRole, cd.Destination, cd.SourceRole, cd.SourceNetwork, cd.SourceCIDR, cd.NodeName)
 }
 
-func RemoveDups(outPuts []ComDetails) []ComDetails {
-	allKeys := make(map[string]bool)
-	res := []ComDetails{}
-	for _, item := range outPuts {
-		str := fmt.Sprintf("%s-%s-%s", item.NodeRole, item.Port, item.Protocol)
-		if _, value := allKeys[str]; !value {
-			allKeys[str] = true
-			res = append(res, item)
+// FieldError reports an invalid field of an entry.
+type FieldError struct {
+	// Field is the JSON name of the field.
+	Field string
+	Value string
+	// Reason describes why the value is invalid.
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field %s: invalid value %q: %s", e.Field, e.Value, e.Reason)
+}
+
+var validDirections = []string{consts.IngressLabel, consts.EgressLabel}
+
+const nodeRoleReason = "must be a node role, e.g. master, worker or infra"
+
+// isValidRole returns true if role is a valid name of a node role, i.e. of a
+// node-role.kubernetes.io/<role> label.
+func isValidRole(role string) bool {
+	return role != "" && len(validation.IsQualifiedName(consts.RoleLabel+role)) == 0
+}
+
+// Validate checks that the entry has a known direction and protocol, a valid node role,
+// a port number in range, and destination fields only if it is an egress entry,
+// or source fields only if it is an ingress entry.
+// The returned error joins a *FieldError per invalid field.
+func (cd ComDetails) Validate() error {
+	var errs []error
+
+	if !contains(validDirections, cd.Direction) {
+		errs = append(errs, &FieldError{Field: "direction", Value: cd.Direction, Reason: "must be one of " + strings.Join(validDirections, ", ")})
+	}
+
+	if !cd.Protocol.IsValid() {
+		errs = append(errs, &FieldError{Field: "protocol", Value: string(cd.Protocol), Reason: "must be one of " + joinProtocols(validProtocols)})
+	}
+
+	if !cd.Port.IsValid() {
+		errs = append(errs, &FieldError{Field: "port", Value: cd.Port.String(), Reason: portReason})
+	}
+
+	if !isValidRole(cd.NodeRole) {
+		errs = append(errs, &FieldError{Field: "nodeRole", Value: cd.NodeRole, Reason: nodeRoleReason})
+	}
+
+	if !cd.AddressFamily.IsValid() {
+		errs = append(errs, &FieldError{Field: "addressFamily", Value: string(cd.AddressFamily), Reason: addressFamilyReason})
+	}
+
+	if cd.DestinationRole != "" && !isValidRole(cd.DestinationRole) {
+		errs = append(errs, &FieldError{Field: "destinationRole", Value: cd.DestinationRole, Reason: nodeRoleReason})
+	}
+
+	if cd.SourceRole != "" && !isValidRole(cd.SourceRole) {
+		errs = append(errs, &FieldError{Field: "sourceRole", Value: cd.SourceRole, Reason: nodeRoleReason})
+	}
+
+	if !cd.SourceNetwork.IsValid() {
+		errs = append(errs, &FieldError{Field: "sourceNetwork", Value: string(cd.SourceNetwork), Reason: networkReason})
+	}
+
+	if _, _, ok := parseAddress(cd.SourceCIDR); cd.SourceCIDR != "" && !ok {
+		errs = append(errs, &FieldError{Field: "sourceCIDR", Value: cd.SourceCIDR, Reason: "must be an IP address or a CIDR"})
+	}
+
+	if cd.Direction == consts.EgressLabel {
+		if cd.SourceRole != "" {
+			errs = append(errs, &FieldError{Field: "sourceRole", Value: cd.SourceRole, Reason: "must be empty for egress entries"})
+		}
+		if cd.SourceNetwork != "" {
+			errs = append(errs, &FieldError{Field: "sourceNetwork", Value: string(cd.SourceNetwork), Reason: "must be empty for egress entries"})
+		}
+		if cd.SourceCIDR != "" {
+			errs = append(errs, &FieldError{Field: "sourceCIDR", Value: cd.SourceCIDR, Reason: "must be empty for egress entries"})
+		}
+	} else {
+		if cd.DestinationRole != "" {
+			errs = append(errs, &FieldError{Field: "destinationRole", Value: cd.DestinationRole, Reason: "must be empty for ingress entries"})
+		}
+		if cd.Destination != "" {
+			errs = append(errs, &FieldError{Field: "destination", Value: cd.Destination, Reason: "must be empty for ingress entries"})
 		}
 	}
 
-	return res
+	return errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveDups removes the entries covered by another entry with DefaultKey,
+// i.e. with the same direction, node role, protocol, sources and
+// destinations, whose ports, address family and node the other entry
+// applies to. Of entries covering each other, the first is kept.
+func RemoveDups(outPuts []ComDetails) []ComDetails {
+	return DefaultKey.RemoveDups(outPuts)
 }
 
-// Diff returns the diff ComMatrix.
+// Diff returns the diff ComMatrix, i.e. the entries of m with ports which are
+// not in an entry of other with the same direction, node role, protocol,
+// sources and destinations, applying to their address family and node. It is
+// DiffByKey with DefaultKey.
 func (m ComMatrix) Diff(other ComMatrix) ComMatrix {
+	return m.DiffByKey(other, DefaultKey)
+}
+
+// DiffByKey returns the entries of m with ports which are not in an entry of
+// other covering them with the given key. Entries with port ranges partially
+// in other are returned with the ranges of their remaining ports, and, when
+// the key has the address family, entries of both address families covered
+// in other for a single family are returned for the other family.
+func (m ComMatrix) DiffByKey(other ComMatrix, key Key) ComMatrix {
 	diff := []ComDetails{}
 	for _, cd1 := range m.Matrix {
-		found := false
-		strComDetail1 := fmt.Sprintf("%s-%s-%s", cd1.NodeRole, cd1.Port, cd1.Protocol)
-		for _, cd2 := range other.Matrix {
-			strComDetail2 := fmt.Sprintf("%s-%s-%s", cd2.NodeRole, cd2.Port, cd2.Protocol)
-			if strComDetail1 == strComDetail2 {
-				found = true
-				break
-			}
-		}
-		if !found {
-			diff = append(diff, cd1)
+		if cd1.AddressFamily != "" || !key.Has("addressFamily") {
+			diff = append(diff, withPorts(cd1, other.uncovered(cd1, key))...)
+			continue
 		}
+
+		v4, v6 := cd1, cd1
+		v4.AddressFamily, v6.AddressFamily = IPv4, IPv6
+		uncovered4, uncovered6 := other.uncovered(v4, key), other.uncovered(v6, key)
+		both := subtractPortRanges(uncovered4, subtractPortRanges(uncovered4, uncovered6))
+
+		diff = append(diff, withPorts(cd1, both)...)
+		diff = append(diff, withPorts(v4, subtractPortRanges(uncovered4, both))...)
+		diff = append(diff, withPorts(v6, subtractPortRanges(uncovered6, both))...)
 	}
 
 	return ComMatrix{Matrix: diff}
 }
+
+// uncovered returns the ports of cd which are not in an entry of m covering
+// cd, but for its ports, with the given key.
+func (m ComMatrix) uncovered(cd ComDetails, key Key) []PortRange {
+	covered := []PortRange{}
+	for _, other := range m.Matrix {
+		candidate := other
+		candidate.Port = cd.Port
+		if key.covers(candidate, cd) {
+			covered = append(covered, other.Port)
+		}
+	}
+
+	return subtractPortRanges([]PortRange{cd.Port}, covered)
+}
+
+// withPorts returns a copy of cd for each of the port ranges.
+func withPorts(cd ComDetails, ranges []PortRange) []ComDetails {
+	res := []ComDetails{}
+	for _, r := range ranges {
+		copied := cd
+		copied.Port = r
+		res = append(res, copied)
+	}
+
+	return res
+}
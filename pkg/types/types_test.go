@@ -0,0 +1,339 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToNftables(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master"},
+		{Direction: "ingress", Protocol: ProtocolUDP, Port: SinglePort(4789), NodeRole: "worker"},
+		{Direction: "ingress", Protocol: ProtocolSCTP, Port: SinglePort(38412), NodeRole: "worker"},
+	}}
+	out, err := m.ToNftables()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	for _, rule := range []string{"tcp dport { 6443,", "udp dport { 4789,", "sctp dport { 38412,"} {
+		if !strings.Contains(string(out), rule) {
+			t.Fatalf("test %s failed. expected the rule in %s", rule, out)
+		}
+	}
+
+	m.Matrix = append(m.Matrix, ComDetails{Direction: "ingress", Protocol: "ICMP", Port: SinglePort(1), NodeRole: "master"})
+	if _, err := m.ToNftables(); err == nil {
+		t.Fatalf("test invalid-protocol failed. expected an error")
+	}
+}
+
+func TestToNftablesAddressFamilies(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master"},
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9100), NodeRole: "master", AddressFamily: IPv4},
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9100), NodeRole: "worker", AddressFamily: IPv6},
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9537), NodeRole: "master", AddressFamily: IPv6},
+	}}
+	out, err := m.ToNftables()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	for _, rule := range []string{"table inet", " tcp dport { 6443, 9100,", "meta nfproto ipv6 tcp dport { 9537,"} {
+		if !strings.Contains(string(out), rule) {
+			t.Fatalf("test %s failed. expected the rule in %s", rule, out)
+		}
+	}
+	if strings.Contains(string(out), "nfproto ipv4") {
+		t.Fatalf("test ipv4 failed. expected no IPv4 only rule in %s", out)
+	}
+}
+
+func TestDiffAddressFamilies(t *testing.T) {
+	dualStack := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(22), NodeRole: "master"}
+	v4 := dualStack
+	v4.AddressFamily = IPv4
+	v6 := dualStack
+	v6.AddressFamily = IPv6
+
+	tests := []struct {
+		desc     string
+		m        []ComDetails
+		other    []ComDetails
+		expected []ComDetails
+	}{
+		{desc: "both-covers-single", m: []ComDetails{v4}, other: []ComDetails{dualStack}, expected: []ComDetails{}},
+		{desc: "single-does-not-cover-both", m: []ComDetails{dualStack}, other: []ComDetails{v4}, expected: []ComDetails{v6}},
+		{desc: "singles-cover-both", m: []ComDetails{dualStack}, other: []ComDetails{v4, v6}, expected: []ComDetails{}},
+		{desc: "other-family", m: []ComDetails{v6}, other: []ComDetails{v4}, expected: []ComDetails{v6}},
+	}
+	for _, test := range tests {
+		res := ComMatrix{Matrix: test.m}.Diff(ComMatrix{Matrix: test.other})
+		if !reflect.DeepEqual(res.Matrix, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, res.Matrix)
+		}
+	}
+}
+
+func TestToNftablesEgress(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master"},
+		{Direction: "egress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "worker", DestinationRole: "master"},
+		{Direction: "egress", Protocol: ProtocolTCP, Port: SinglePort(80), NodeRole: "worker", Destination: "169.254.169.254"},
+		{Direction: "egress", Protocol: ProtocolUDP, Port: SinglePort(123), NodeRole: "worker", Destination: "fd00::/64"},
+		{Direction: "egress", Protocol: ProtocolTCP, Port: SinglePort(443), NodeRole: "worker", Destination: "quay.io"},
+	}}
+	out, err := m.ToNftables()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	_, output, found := strings.Cut(string(out), "chain output")
+	if !found {
+		t.Fatalf("test output-chain failed. expected an output chain in %s", out)
+	}
+	for _, rule := range []string{"policy accept;", " tcp dport { 6443,", "ip daddr 169.254.169.254 tcp dport { 80,", "ip6 daddr fd00::/64 udp dport { 123,",
+		`443,  } accept comment "to quay.io, allowed to any address as it is not an IP address";`} {
+		if !strings.Contains(output, rule) {
+			t.Fatalf("test %s failed. expected the rule in the output chain %s", rule, output)
+		}
+	}
+
+	out, err = m.ToNftablesWithOptions(NftablesOptions{DropEgress: true})
+	if err != nil {
+		t.Fatalf("test drop-egress failed: %v", err)
+	}
+	if _, output, _ = strings.Cut(string(out), "chain output"); !strings.Contains(output, "policy drop;") {
+		t.Fatalf("test drop-egress failed. expected a drop policy in the output chain %s", output)
+	}
+}
+
+func TestDiffDirections(t *testing.T) {
+	ingress := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master"}
+	egress := ComDetails{Direction: "egress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master", DestinationRole: "master"}
+
+	res := ComMatrix{Matrix: []ComDetails{ingress, egress}}.Diff(ComMatrix{Matrix: []ComDetails{ingress}})
+	if !reflect.DeepEqual(res.Matrix, []ComDetails{egress}) {
+		t.Fatalf("test failed. expected %v got %v", []ComDetails{egress}, res.Matrix)
+	}
+}
+
+func TestToNftablesSources(t *testing.T) {
+	m := ComMatrix{Matrix: []ComDetails{
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master", SourceNetwork: NetworkExternal},
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(2379), NodeRole: "master", SourceCIDR: "10.0.0.0/16"},
+		{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9100), NodeRole: "master", SourceCIDR: "fd01::1"},
+	}}
+	out, err := m.ToNftables()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	for _, rule := range []string{" tcp dport { 6443,", "ip saddr 10.0.0.0/16 tcp dport { 2379,", "ip6 saddr fd01::1 tcp dport { 9100,"} {
+		if !strings.Contains(string(out), rule) {
+			t.Fatalf("test %s failed. expected the rule in %s", rule, out)
+		}
+	}
+
+	egress := ComDetails{Direction: "egress", Protocol: ProtocolTCP, Port: SinglePort(443), NodeRole: "master", SourceNetwork: NetworkPod}
+	if err := egress.Validate(); err == nil {
+		t.Fatalf("test egress-source failed. expected an error")
+	}
+}
+
+func TestRestrictSources(t *testing.T) {
+	m := ComMatrix{
+		Matrix: []ComDetails{
+			{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(22), NodeRole: "master", SourceNetwork: NetworkExternal},
+			{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(2379), NodeRole: "master", SourceRole: "master"},
+			{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9537), NodeRole: "master", SourceNetwork: NetworkPod},
+		},
+		Networks: &ClusterNetworks{
+			MachineNetworks: []string{"192.168.0.0/24"},
+			PodNetworks:     []string{"10.128.0.0/14", "fd01::/48"},
+		},
+	}
+	res, err := m.RestrictSources()
+	if err != nil {
+		t.Fatalf("test failed: %v", err)
+	}
+
+	expected := []string{"", "192.168.0.0/24", "10.128.0.0/14", "fd01::/48"}
+	cidrs := []string{}
+	for _, cd := range res.Matrix {
+		cidrs = append(cidrs, cd.SourceCIDR)
+	}
+	if !reflect.DeepEqual(cidrs, expected) {
+		t.Fatalf("test failed. expected %v got %v", expected, cidrs)
+	}
+
+	if _, err := (&ComMatrix{}).RestrictSources(); err == nil {
+		t.Fatalf("test unknown-networks failed. expected an error")
+	}
+}
+
+func TestNodeNames(t *testing.T) {
+	allWorkers := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9100), NodeRole: "worker"}
+	worker1 := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(8443), NodeRole: "worker", NodeName: "worker-1"}
+	worker2 := worker1
+	worker2.NodeName = "worker-2"
+	m := ComMatrix{Matrix: []ComDetails{allWorkers, worker1}}
+
+	res := m.ForNode("worker-2", []string{"worker"})
+	if !reflect.DeepEqual(res.Matrix, []ComDetails{allWorkers}) {
+		t.Fatalf("test for-node failed. expected %v got %v", []ComDetails{allWorkers}, res.Matrix)
+	}
+
+	diff := ComMatrix{Matrix: []ComDetails{worker2}}.Diff(m)
+	if !reflect.DeepEqual(diff.Matrix, []ComDetails{worker2}) {
+		t.Fatalf("test diff failed. expected %v got %v", []ComDetails{worker2}, diff.Matrix)
+	}
+
+	perNode := allWorkers
+	perNode.NodeName = "worker-1"
+	dedup := RemoveDups([]ComDetails{perNode, allWorkers, worker1, worker2})
+	if !reflect.DeepEqual(dedup, []ComDetails{allWorkers, worker1, worker2}) {
+		t.Fatalf("test remove-dups failed. expected %v got %v", []ComDetails{allWorkers, worker1, worker2}, dedup)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	api := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master", Service: "kubernetes"}
+	ssh := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(22), NodeRole: "master", Service: "sshd"}
+	dns := ComDetails{Direction: "ingress", Protocol: ProtocolUDP, Port: SinglePort(53), NodeRole: "worker", Service: "dns-default"}
+	router := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(443), NodeRole: "worker", Service: "router", SourceCIDR: "10.0.0.0/8"}
+	renamed := dns
+	renamed.Service, renamed.Optional = "dns", true
+
+	old := ComMatrix{Matrix: []ComDetails{api, ssh, dns}}
+	res := old.Compare(ComMatrix{Matrix: []ComDetails{api, renamed, router}})
+
+	expected := Comparison{
+		Added:   []ComDetails{router},
+		Removed: []ComDetails{ssh},
+		Changed: []Change{{Old: dns, New: renamed, Fields: []FieldChange{
+			{Field: "service", Old: "dns-default", New: "dns"},
+			{Field: "optional", Old: "false", New: "true"},
+		}}},
+		Unchanged: 1,
+		Key:       DefaultKey,
+	}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("test failed. expected %v got %v", expected, res)
+	}
+
+	out, err := res.ToCSV()
+	if err != nil {
+		t.Fatalf("test csv failed: %v", err)
+	}
+	if !strings.Contains(string(out), "changed,ingress,UDP,53,,dns,,,worker,true,,,,,,,,service: dns-default -> dns; optional: false -> true\n") {
+		t.Fatalf("test csv failed. got %s", out)
+	}
+
+	md := string(res.ToMarkdown())
+	if !strings.HasPrefix(md, "1 added, 1 removed, 1 changed, 1 unchanged.\n") || !strings.Contains(md, "| ingress UDP 53 worker | service | dns-default | dns |\n") {
+		t.Fatalf("test markdown failed. got %s", md)
+	}
+	if !strings.Contains(md, "| direction | protocol | port | namespace | service | pod | container | nodeRole | optional | addressFamily | destinationRole | destination | sourceRole | sourceNetwork | sourceCIDR | nodeName |\n") ||
+		!strings.Contains(md, "| ingress | TCP | 443 |  | router |  |  | worker | false |  |  |  |  |  | 10.0.0.0/8 |  |\n") {
+		t.Fatalf("test markdown-fields failed. got %s", md)
+	}
+
+	if !old.Compare(old).IsEmpty() {
+		t.Fatalf("test same-matrix failed. expected no changes")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	master := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(9100), NodeRole: "master", Service: "node-exporter"}
+	worker := master
+	worker.NodeRole = "worker"
+	other := worker
+	other.Service = "other"
+
+	anyRole, err := ParseKey("direction,protocol,port")
+	if err != nil {
+		t.Fatalf("test parse failed: %v", err)
+	}
+	withService, err := ParseKey("direction, protocol, port, nodeRole, service")
+	if err != nil {
+		t.Fatalf("test parse failed: %v", err)
+	}
+	if _, err := ParseKey("protocol,nodeRole"); err == nil {
+		t.Fatalf("test parse-without-port failed. expected an error")
+	}
+	if _, err := ParseKey("port,hostname"); err == nil {
+		t.Fatalf("test parse-unknown-field failed. expected an error")
+	}
+
+	tests := []struct {
+		desc  string
+		key   Key
+		dedup []ComDetails
+		diff  []ComDetails
+	}{
+		{desc: "default", key: DefaultKey, dedup: []ComDetails{master, worker}, diff: []ComDetails{}},
+		{desc: "any-role", key: anyRole, dedup: []ComDetails{master}, diff: []ComDetails{}},
+		{desc: "with-service", key: withService, dedup: []ComDetails{master, worker, other}, diff: []ComDetails{other}},
+	}
+	for _, test := range tests {
+		res := test.key.RemoveDups([]ComDetails{master, worker, other})
+		if !reflect.DeepEqual(res, test.dedup) {
+			t.Fatalf("test %s dedup failed. expected %v got %v", test.desc, test.dedup, res)
+		}
+
+		diff := ComMatrix{Matrix: []ComDetails{other}}.DiffByKey(ComMatrix{Matrix: []ComDetails{master, worker}}, test.key)
+		if !reflect.DeepEqual(diff.Matrix, test.diff) {
+			t.Fatalf("test %s diff failed. expected %v got %v", test.desc, test.diff, diff.Matrix)
+		}
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	api := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(6443), NodeRole: "master", Service: "kubernetes"}
+	ssh := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(22), NodeRole: "master", Service: "sshd"}
+	nodePorts := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: PortRange{Start: 30000, End: 32767}, NodeRole: "worker"}
+	nodePort := ComDetails{Direction: "ingress", Protocol: ProtocolTCP, Port: SinglePort(30080), NodeRole: "worker", Service: "app"}
+	curated := api
+	curated.Service, curated.Optional = "kube-apiserver", true
+
+	left := ComMatrix{Matrix: []ComDetails{api, ssh, nodePort}}
+	right := ComMatrix{Matrix: []ComDetails{curated, nodePorts}}
+
+	tests := []struct {
+		desc     string
+		res      ComMatrix
+		expected []ComDetails
+	}{
+		{desc: "union", res: left.Union(right, DefaultKey), expected: []ComDetails{api, ssh, nodePorts}},
+		{desc: "intersect", res: left.Intersect(right, DefaultKey), expected: []ComDetails{api, nodePort}},
+		{desc: "subtract", res: left.Subtract(right, DefaultKey), expected: []ComDetails{ssh}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.res.Matrix, test.expected) {
+			t.Fatalf("test %s failed. expected %v got %v", test.desc, test.expected, test.res.Matrix)
+		}
+	}
+
+	for policy, expected := range map[ConflictPolicy][]ComDetails{
+		PreferLeft:  {api, ssh, nodePorts},
+		PreferRight: {curated, ssh, nodePorts},
+	} {
+		res, err := left.Merge(right, DefaultKey, policy)
+		if err != nil {
+			t.Fatalf("test merge-%s failed: %v", policy, err)
+		}
+		if !reflect.DeepEqual(res.Matrix, expected) {
+			t.Fatalf("test merge-%s failed. expected %v got %v", policy, expected, res.Matrix)
+		}
+	}
+
+	_, err := left.Merge(right, DefaultKey, FailOnConflict)
+	var conflictErr *MergeConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 || conflictErr.Conflicts[0].New != curated {
+		t.Fatalf("test merge-error failed. expected a conflict on %v got %v", curated, err)
+	}
+}
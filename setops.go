@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+func runUnion(_ context.Context, args []string) int {
+	return runSetOperation("union", "Print the entries of <a> and <b>", args,
+		func(a, b *types.ComMatrix, key types.Key) (types.ComMatrix, error) {
+			return a.Union(*b, key), nil
+		})
+}
+
+func runIntersect(_ context.Context, args []string) int {
+	return runSetOperation("intersect", "Print the entries of <a>, or their ports, found in <b>", args,
+		func(a, b *types.ComMatrix, key types.Key) (types.ComMatrix, error) {
+			return a.Intersect(*b, key), nil
+		})
+}
+
+func runSubtract(_ context.Context, args []string) int {
+	return runSetOperation("subtract", "Print the entries of <a>, or their ports, not found in <b>", args,
+		func(a, b *types.ComMatrix, key types.Key) (types.ComMatrix, error) {
+			return a.Subtract(*b, key), nil
+		})
+}
+
+func runMerge(_ context.Context, args []string) int {
+	policy := types.FailOnConflict
+	return runSetOperation("merge", "Print the entries of <a> and <b>, resolving the entries of both with the same --key fields "+
+		"but different other fields by --on-conflict", args,
+		func(a, b *types.ComMatrix, key types.Key) (types.ComMatrix, error) {
+			return a.Merge(*b, key, policy)
+		},
+		func(fs *flag.FlagSet) {
+			fs.Func("on-conflict", "conflict policy, one of prefer-left, prefer-right or error. error fails listing the conflicting entries (default error)",
+				func(value string) (err error) {
+					policy, err = types.ParseConflictPolicy(value)
+					return err
+				})
+		})
+}
+
+// runSetOperation runs a command applying the operation to the matrices of
+// the two files given as args, and prints the resulting matrix.
+func runSetOperation(name, summary string, args []string, operation func(a, b *types.ComMatrix, key types.Key) (types.ComMatrix, error),
+	addFlags ...func(fs *flag.FlagSet)) int {
+	fs := newFlagSet(name, "<a> <b>", summary)
+	format := fs.String("format", "csv", "output format, one of csv, json, yaml or nft")
+	key := addKeyFlag(fs)
+	for _, add := range addFlags {
+		add(fs)
+	}
+
+	if code, ok := parseFlags(fs, args, 2); !ok {
+		return code
+	}
+	if _, ok := formats[*format]; !ok {
+		fmt.Fprintf(os.Stderr, "error: unsupported format %q, supported formats are csv, json, yaml and nft\n", *format)
+		return exitUsage
+	}
+
+	a, err := commatrix.NewFromFile(fs.Arg(0))
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	b, err := commatrix.NewFromFile(fs.Arg(1))
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	res, err := operation(a, b, *key)
+	var conflictErr *types.MergeConflictError
+	if errors.As(err, &conflictErr) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitDiff
+	}
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	out, err := marshalMatrix(&res, *format, types.NftablesOptions{})
+	if err != nil {
+		return errorf("failed converting the matrix to %s: %v", *format, err)
+	}
+	fmt.Print(string(out))
+
+	return exitOK
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/commatrix"
+	"github.com/liornoy/node-comm-lib/pkg/types"
+)
+
+func runValidate(_ context.Context, args []string) int {
+	fs := newFlagSet("validate", "<file>", "Validate every entry of a JSON, YAML or CSV communication matrix or custom entries file")
+
+	if code, ok := parseFlags(fs, args, 1); !ok {
+		return code
+	}
+
+	customEntries, err := commatrix.ReadCustomEntriesFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		var entryErr *types.EntryError
+		if errors.As(err, &entryErr) {
+			return exitDiff
+		}
+
+		return exitError
+	}
+
+	fmt.Printf("%s: %d entries are valid\n", fs.Arg(0), len(customEntries))
+
+	return exitOK
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/liornoy/node-comm-lib/commatrix"
+)
+
+func runVerify(ctx context.Context, args []string) int {
+	fs := newFlagSet("verify", "", "Generate the communication matrix and compare its ingress entries against the ports the nodes listen on, as reported by 'ss'.\n"+
+		"Ports listened on but missing from the matrix are prefixed with '+', matrix entries no node listens on with '-'")
+	mf := addMatrixFlags(fs)
+	key := addKeyFlag(fs)
+
+	if code, ok := parseFlags(fs, args, 0); !ok {
+		return code
+	}
+	// The matrix is compared against the ss entries, so it can't contain them.
+	for _, name := range mf.sources {
+		if name == commatrix.SSSourceName {
+			fmt.Fprintf(os.Stderr, "error: --source %s is not supported by verify, which compares the matrix against the ports ss reports\n", name)
+			return exitUsage
+		}
+	}
+
+	opts, err := mf.options(ctx)
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	mat, err := commatrix.NewWithOptions(ctx, opts)
+	if err != nil {
+		return errorf("failed generating the communication matrix: %v", err)
+	}
+
+	ssComDetails, err := commatrix.NewSSSource(opts).ComDetails(ctx)
+	if err != nil {
+		return errorf("%v", err)
+	}
+
+	topology, err := commatrix.DetectTopology(ctx, opts.ClientSet)
+	if err != nil {
+		return errorf("failed detecting the cluster topology: %v", err)
+	}
+
+	undocumented, notListening := commatrix.CompareListening(mat, commatrix.ApplyTopology(ssComDetails, topology), *key)
+	for _, cd := range undocumented.Matrix {
+		fmt.Printf("+%s\n", cd)
+	}
+	for _, cd := range notListening.Matrix {
+		fmt.Printf("-%s\n", cd)
+	}
+
+	if len(undocumented.Matrix) > 0 || len(notListening.Matrix) > 0 {
+		return exitDiff
+	}
+
+	return exitOK
+}